@@ -0,0 +1,146 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Trendyol/go-dcp-mongodb/mongodb/bulk"
+	"github.com/Trendyol/go-dcp/logger"
+)
+
+type Controller interface {
+	Pause()
+	Resume()
+	Flush(ctx context.Context) error
+	Status() bulk.Status
+	Health(ctx context.Context) Health
+}
+
+type Health struct {
+	LastFlushTime  time.Time `json:"lastFlushTime"`
+	MongoDBError   string    `json:"mongodbError,omitempty"`
+	SinceLastFlush string    `json:"sinceLastFlush"`
+	MongoDB        bool      `json:"mongodb"`
+	BulkAlive      bool      `json:"bulkAlive"`
+	DcpReady       bool      `json:"dcpReady"`
+	Live           bool      `json:"live"`
+	Ready          bool      `json:"ready"`
+}
+
+type Server struct {
+	server *http.Server
+}
+
+// NewHandler returns the admin endpoints so they can be mounted on an existing http.ServeMux,
+// e.g. mux.Handle("/mongodb/", http.StripPrefix("/mongodb", admin.NewHandler(connector))).
+func NewHandler(controller Controller) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, controller.Status())
+	})
+
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, _ *http.Request) {
+		controller.Pause()
+		writeJSON(w, http.StatusOK, controller.Status())
+	})
+
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, _ *http.Request) {
+		controller.Resume()
+		writeJSON(w, http.StatusOK, controller.Status())
+	})
+
+	mux.HandleFunc("POST /flush", func(w http.ResponseWriter, r *http.Request) {
+		if err := controller.Flush(r.Context()); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, controller.Status())
+	})
+
+	mux.HandleFunc("GET /health/live", func(w http.ResponseWriter, r *http.Request) {
+		health := controller.Health(r.Context())
+		writeJSON(w, healthStatusCode(health.Live), health)
+	})
+
+	mux.HandleFunc("GET /health/ready", func(w http.ResponseWriter, r *http.Request) {
+		health := controller.Health(r.Context())
+		writeJSON(w, healthStatusCode(health.Ready), health)
+	})
+
+	return mux
+}
+
+func healthStatusCode(ok bool) int {
+	if ok {
+		return http.StatusOK
+	}
+	return http.StatusServiceUnavailable
+}
+
+// RequireToken rejects requests without an "Authorization: Bearer <token>" header, except the health checks so
+// probes keep working. The handler is returned as is when token is empty.
+func RequireToken(token string, handler http.Handler) http.Handler {
+	if token == "" {
+		return handler
+	}
+
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := []byte(r.Header.Get("Authorization"))
+		if !strings.HasPrefix(r.URL.Path, "/health/") && subtle.ConstantTimeCompare(authorization, expected) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// NewServer listens on host, which should stay a loopback or internal address since pause and flush change the
+// state of the connector.
+func NewServer(host string, port int, handler http.Handler) *Server {
+	return &Server{
+		server: &http.Server{
+			Addr:              net.JoinHostPort(host, strconv.Itoa(port)),
+			Handler:           handler,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+	}
+}
+
+func (s *Server) Listen() {
+	logger.Log.Info("admin api starting on %s", s.server.Addr)
+
+	err := s.server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Log.Error("admin api cannot start on %s, err: %v", s.server.Addr, err)
+		return
+	}
+
+	logger.Log.Info("admin api stopped")
+}
+
+func (s *Server) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.server.Shutdown(ctx); err != nil {
+		logger.Log.Error("error while admin api shutdown, err: %v", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Log.Error("error while writing admin api response, err: %v", err)
+	}
+}
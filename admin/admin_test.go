@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Trendyol/go-dcp-mongodb/mongodb/bulk"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeController struct {
+	status  bulk.Status
+	health  Health
+	flushed int
+}
+
+func (f *fakeController) Pause()  { f.status.Paused = true }
+func (f *fakeController) Resume() { f.status.Paused = false }
+func (f *fakeController) Flush(_ context.Context) error {
+	f.flushed++
+	return nil
+}
+
+func (f *fakeController) Status() bulk.Status {
+	return f.status
+}
+
+func (f *fakeController) Health(_ context.Context) Health {
+	return f.health
+}
+
+func TestHandler(t *testing.T) {
+	controller := &fakeController{
+		status: bulk.Status{
+			BatchSize:   3,
+			Collections: map[string]bulk.CollectionStats{"test": {UpdateSuccess: 5}},
+		},
+	}
+	handler := NewHandler(controller)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+		expectedPaused bool
+	}{
+		{name: "status", method: http.MethodGet, path: "/status", expectedStatus: http.StatusOK},
+		{name: "pause", method: http.MethodPost, path: "/pause", expectedStatus: http.StatusOK, expectedPaused: true},
+		{name: "resume", method: http.MethodPost, path: "/resume", expectedStatus: http.StatusOK},
+		{name: "flush", method: http.MethodPost, path: "/flush", expectedStatus: http.StatusOK},
+		{name: "wrong method", method: http.MethodGet, path: "/pause", expectedStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.path, nil))
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var status bulk.Status
+			assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+			assert.Equal(t, tt.expectedPaused, status.Paused)
+			assert.Equal(t, 3, status.BatchSize)
+			assert.Equal(t, int64(5), status.Collections["test"].UpdateSuccess)
+		})
+	}
+
+	assert.Equal(t, 1, controller.flushed)
+}
+
+func TestHandler_Health(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		health         Health
+		expectedStatus int
+	}{
+		{name: "live", path: "/health/live", health: Health{Live: true}, expectedStatus: http.StatusOK},
+		{name: "not live", path: "/health/live", health: Health{}, expectedStatus: http.StatusServiceUnavailable},
+		{name: "ready", path: "/health/ready", health: Health{Live: true, Ready: true}, expectedStatus: http.StatusOK},
+		{name: "not ready", path: "/health/ready", health: Health{Live: true}, expectedStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler(&fakeController{health: tt.health})
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+		})
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	handler := RequireToken("secret", NewHandler(&fakeController{health: Health{Live: true}}))
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		authorization  string
+		expectedStatus int
+	}{
+		{name: "valid token", method: http.MethodPost, path: "/flush", authorization: "Bearer secret", expectedStatus: http.StatusOK},
+		{name: "missing token", method: http.MethodPost, path: "/flush", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodPost, path: "/pause", authorization: "Bearer other", expectedStatus: http.StatusUnauthorized},
+		{name: "health without token", method: http.MethodGet, path: "/health/live", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+		})
+	}
+}
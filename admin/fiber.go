@@ -0,0 +1,18 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+)
+
+// Mount serves handler under prefix of a fiber app, e.g. the one of a service that already runs fiber. go-dcp creates
+// its own API server internally without a way to add routes, so the admin endpoints cannot be mounted on that one:
+//
+//	admin.Mount(app, "/mongodb", controller.AdminHandler())
+func Mount(app *fiber.App, prefix string, handler http.Handler) {
+	prefix = "/" + strings.Trim(prefix, "/")
+	app.Use(prefix, adaptor.HTTPHandler(http.StripPrefix(prefix, handler)))
+}
@@ -0,0 +1,42 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Trendyol/go-dcp-mongodb/mongodb/bulk"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMount(t *testing.T) {
+	controller := &fakeController{status: bulk.Status{BatchSize: 3}}
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/status", func(c *fiber.Ctx) error { return c.SendString("OK") })
+	Mount(app, "/mongodb/", RequireToken("secret", NewHandler(controller)))
+
+	request := httptest.NewRequest(http.MethodPost, "/mongodb/pause", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	response, err := app.Test(request)
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	var status bulk.Status
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&status))
+	assert.True(t, status.Paused)
+	assert.Equal(t, 3, status.BatchSize)
+
+	unauthorized, err := app.Test(httptest.NewRequest(http.MethodPost, "/mongodb/flush", nil))
+	assert.NoError(t, err)
+	defer unauthorized.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, unauthorized.StatusCode)
+	assert.Equal(t, 0, controller.flushed)
+
+	unmounted, err := app.Test(httptest.NewRequest(http.MethodGet, "/status", nil))
+	assert.NoError(t, err)
+	defer unmounted.Body.Close()
+	assert.Equal(t, http.StatusOK, unmounted.StatusCode)
+}
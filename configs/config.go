@@ -16,13 +16,20 @@ type Config struct {
 }
 
 type MongoDB struct {
-	Connection        Connection        `yaml:"connection" mapstructure:"connection"`
-	Collection        string            `yaml:"collection"`
-	CollectionMapping map[string]string `yaml:"collectionMapping" mapstructure:"collectionMapping"`
-	Batch             BatchConfig       `yaml:"batch" mapstructure:"batch"`
-	ConnectionPool    ConnectionPool    `yaml:"connectionPool" mapstructure:"connectionPool"`
-	Timeouts          Timeouts          `yaml:"timeouts" mapstructure:"timeouts"`
-	ShardKeys         []string          `yaml:"shardKeys,omitempty" mapstructure:"shardKeys"`
+	Connection        Connection                   `yaml:"connection" mapstructure:"connection"`
+	Collection        string                       `yaml:"collection"`
+	CollectionMapping map[string]string            `yaml:"collectionMapping" mapstructure:"collectionMapping"`
+	CollectionOptions map[string]CollectionOptions `yaml:"collectionOptions" mapstructure:"collectionOptions"`
+	Batch             BatchConfig                  `yaml:"batch" mapstructure:"batch"`
+	ConnectionPool    ConnectionPool               `yaml:"connectionPool" mapstructure:"connectionPool"`
+	Timeouts          Timeouts                     `yaml:"timeouts" mapstructure:"timeouts"`
+	Driver            Driver                       `yaml:"driver" mapstructure:"driver"`
+	Transaction       Transaction                  `yaml:"transaction" mapstructure:"transaction"`
+	ShardKeys         []string                     `yaml:"shardKeys,omitempty" mapstructure:"shardKeys"`
+	Provisioning      Provisioning                 `yaml:"provisioning" mapstructure:"provisioning"`
+	DryRun            DryRun                       `yaml:"dryRun" mapstructure:"dryRun"`
+	Admin             Admin                        `yaml:"admin" mapstructure:"admin"`
+	Health            Health                       `yaml:"health" mapstructure:"health"`
 }
 
 type Connection struct {
@@ -32,12 +39,192 @@ type Connection struct {
 	Database string `yaml:"database"`
 }
 
+// CollectionOptions configures writes to a MongoDB collection, keyed by the collection name.
+type CollectionOptions struct {
+	Merge              MergeOptions      `yaml:"merge" mapstructure:"merge"`
+	History            HistoryOptions    `yaml:"history" mapstructure:"history"`
+	SCD                SCDOptions        `yaml:"scd" mapstructure:"scd"`
+	TimeSeries         TimeSeriesOptions `yaml:"timeseries" mapstructure:"timeseries"`
+	Schema             SchemaOptions     `yaml:"schema" mapstructure:"schema"`
+	Create             CreateOptions     `yaml:"create" mapstructure:"create"`
+	Indexes            []IndexOptions    `yaml:"indexes" mapstructure:"indexes"`
+	DuplicateKeyPolicy string            `yaml:"duplicateKeyPolicy"`
+	MaxRetries         int               `yaml:"maxRetries"`
+	Ordered            bool              `yaml:"ordered"`
+}
+
+const (
+	DuplicateKeyPolicyIgnore     = "ignore"
+	DuplicateKeyPolicyOverwrite  = "overwrite"
+	DuplicateKeyPolicyDeadLetter = "deadLetter"
+	DuplicateKeyPolicyFail       = "fail"
+)
+
+const (
+	MergeNullFieldsSet   = "set"
+	MergeNullFieldsUnset = "unset"
+	MergeArraysReplace   = "replace"
+	MergeArraysAddToSet  = "addToSet"
+)
+
+const (
+	HistoryDocumentFull = "full"
+	HistoryDocumentDiff = "diff"
+)
+
+// HistoryOptions appends a record of every event written to the collection to its history collection,
+// <collection>_history unless Collection is set. Records older than Retention are removed by a TTL index.
+type HistoryOptions struct {
+	Collection string        `yaml:"collection"`
+	Document   string        `yaml:"document"`
+	Retention  time.Duration `yaml:"retention"`
+	Enabled    bool          `yaml:"enabled"`
+	Only       bool          `yaml:"only"`
+}
+
+// SCDOptions writes the collection as a slowly changing dimension of type 2. Every change opens a new version
+// with ValidFromField and VersionField and closes the versions before it by setting ValidToField, versions are
+// identified by an {id, cas} _id. It requires Transaction.Scope, so both writes of a change apply together.
+type SCDOptions struct {
+	ValidFromField string `yaml:"validFromField"`
+	ValidToField   string `yaml:"validToField"`
+	VersionField   string `yaml:"versionField"`
+	Enabled        bool   `yaml:"enabled"`
+}
+
+const (
+	TimeSeriesGranularitySeconds = "seconds"
+	TimeSeriesGranularityMinutes = "minutes"
+	TimeSeriesGranularityHours   = "hours"
+)
+
+// TimeSeriesOptions makes the collection a time-series collection, created on startup when it does not exist.
+// Every mutation is inserted as a measurement with TimeField read from SourceField of the document, or TimeField
+// when SourceField is empty, falling back to the event time when the document has no such field.
+type TimeSeriesOptions struct {
+	TimeField   string        `yaml:"timeField"`
+	SourceField string        `yaml:"sourceField"`
+	MetaField   string        `yaml:"metaField"`
+	Granularity string        `yaml:"granularity"`
+	ExpireAfter time.Duration `yaml:"expireAfter"`
+	Enabled     bool          `yaml:"enabled"`
+}
+
+const (
+	SchemaPolicySkip       = "skip"
+	SchemaPolicyDeadLetter = "deadLetter"
+	SchemaPolicyFlag       = "flag"
+	SchemaPolicyHalt       = "halt"
+)
+
+// SchemaOptions validates the mapped documents of the collection against a JSON Schema read from File or given
+// Inline. Invalid documents are handled by Policy, deadLetter by default, and flag writes them with their validation
+// errors in FlagField.
+type SchemaOptions struct {
+	Inline    map[string]any `yaml:"inline"`
+	File      string         `yaml:"file"`
+	Policy    string         `yaml:"policy"`
+	FlagField string         `yaml:"flagField"`
+}
+
+// IsEnabled reports whether a schema is configured.
+func (s *SchemaOptions) IsEnabled() bool {
+	return s.File != "" || s.Inline != nil
+}
+
+// CreateOptions are the options a collection is created with on startup when it does not exist yet.
+// Capped and clustered collections cannot be changed afterwards, the validator of an existing collection is updated.
+type CreateOptions struct {
+	Validator        map[string]any `yaml:"validator"`
+	ValidationLevel  string         `yaml:"validationLevel"`
+	ValidationAction string         `yaml:"validationAction"`
+	SizeBytes        int64          `yaml:"sizeBytes"`
+	MaxDocuments     int64          `yaml:"maxDocuments"`
+	Capped           bool           `yaml:"capped"`
+	Clustered        bool           `yaml:"clustered"`
+}
+
+const (
+	IndexTypeText     = "text"
+	IndexType2D       = "2d"
+	IndexType2DSphere = "2dsphere"
+	IndexTypeHashed   = "hashed"
+)
+
+// IndexOptions is an index ensured on startup. Name defaults to the name MongoDB generates from the keys,
+// ExpireAfter makes it a TTL index.
+type IndexOptions struct {
+	Collation     *Collation     `yaml:"collation"`
+	PartialFilter map[string]any `yaml:"partialFilter"`
+	Name          string         `yaml:"name"`
+	Keys          []IndexKey     `yaml:"keys"`
+	ExpireAfter   time.Duration  `yaml:"expireAfter"`
+	Unique        bool           `yaml:"unique"`
+}
+
+// IndexKey is a field of an index, ascending unless Direction is -1 or Type is set.
+type IndexKey struct {
+	Field     string `yaml:"field"`
+	Type      string `yaml:"type"`
+	Direction int    `yaml:"direction"`
+}
+
+type Collation struct {
+	Locale   string `yaml:"locale"`
+	Strength int    `yaml:"strength"`
+}
+
+// Provisioning reports the differences between the configured and the existing collections and indexes
+// without changing them when DryRun is set.
+type Provisioning struct {
+	DryRun   bool `yaml:"dryRun"`
+	Disabled bool `yaml:"disabled"`
+}
+
+// DryRun sends the write models of the batches to a sink instead of MongoDB and provisions nothing. No client is
+// created for it. Checkpoints are only committed with Commit, so the same events are written once dry run is disabled.
+type DryRun struct {
+	Sink    string `yaml:"sink"`
+	File    string `yaml:"file"`
+	Enabled bool   `yaml:"enabled"`
+	Commit  bool   `yaml:"commit"`
+}
+
+const (
+	DryRunSinkLog  = "log"
+	DryRunSinkFile = "file"
+)
+
+// MergeOptions configures how mongodb.Merge writes, and Update and Upsert writes when Default is set,
+// deep-merge the incoming document into the existing one.
+type MergeOptions struct {
+	NullFields string `yaml:"nullFields"`
+	Arrays     string `yaml:"arrays"`
+	Default    bool   `yaml:"default"`
+}
+
 type BatchConfig struct {
-	SizeLimit            int            `yaml:"sizeLimit"`
-	ByteSizeLimit        any            `yaml:"byteSizeLimit"`
-	ConcurrentRequest    int            `yaml:"concurrentRequest"`
-	TickerDuration       time.Duration  `yaml:"tickerDuration"`
-	CommitTickerDuration *time.Duration `yaml:"commitTickerDuration"`
+	SizeLimit            int                 `yaml:"sizeLimit"`
+	ByteSizeLimit        any                 `yaml:"byteSizeLimit"`
+	ConcurrentRequest    int                 `yaml:"concurrentRequest"`
+	MaxInFlightBatches   int                 `yaml:"maxInFlightBatches"`
+	MaxBufferedDocuments int                 `yaml:"maxBufferedDocuments"`
+	MaxBufferedBytes     any                 `yaml:"maxBufferedBytes"`
+	Partitions           int                 `yaml:"partitions"`
+	TickerDuration       time.Duration       `yaml:"tickerDuration"`
+	CommitTickerDuration *time.Duration      `yaml:"commitTickerDuration"`
+	Adaptive             AdaptiveBatchConfig `yaml:"adaptive" mapstructure:"adaptive"`
+}
+
+type AdaptiveBatchConfig struct {
+	Enabled              bool          `yaml:"enabled"`
+	MinSizeLimit         int           `yaml:"minSizeLimit"`
+	MaxSizeLimit         int           `yaml:"maxSizeLimit"`
+	MinConcurrentRequest int           `yaml:"minConcurrentRequest"`
+	MaxConcurrentRequest int           `yaml:"maxConcurrentRequest"`
+	TargetLatency        time.Duration `yaml:"targetLatency"`
+	MaxErrorRate         float64       `yaml:"maxErrorRate"`
+	Window               int           `yaml:"window"`
 }
 
 type ConnectionPool struct {
@@ -53,6 +240,41 @@ type Timeouts struct {
 	BulkRequestTimeoutMS     int64 `yaml:"bulkRequestTimeoutMS"`
 }
 
+type Driver struct {
+	Compressors         []string `yaml:"compressors"`
+	AppName             string   `yaml:"appName"`
+	ReplicaSet          string   `yaml:"replicaSet"`
+	HeartbeatIntervalMS int64    `yaml:"heartbeatIntervalMS"`
+	LocalThresholdMS    int64    `yaml:"localThresholdMS"`
+	MaxConnecting       uint64   `yaml:"maxConnecting"`
+	DirectConnection    bool     `yaml:"directConnection"`
+}
+
+const (
+	TransactionScopeEvent = "event"
+	TransactionScopeBatch = "batch"
+)
+
+// Transaction writes the models of an event, or of a whole batch, in one multi-document transaction when Scope is set.
+type Transaction struct {
+	Scope   string        `yaml:"scope"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Admin serves the admin API on Host, the loopback interface by default. With Token set the endpoints other than the
+// health checks require an "Authorization: Bearer <token>" header.
+type Admin struct {
+	Host    string `yaml:"host"`
+	Token   string `yaml:"token"`
+	Port    int    `yaml:"port"`
+	Enabled bool   `yaml:"enabled"`
+}
+
+type Health struct {
+	PingTimeout time.Duration `yaml:"pingTimeout"`
+	MaxFlushAge time.Duration `yaml:"maxFlushAge"`
+}
+
 func (c *Config) ApplyDefaults() {
 	if c.MongoDB.Batch.TickerDuration == 0 {
 		c.MongoDB.Batch.TickerDuration = 10 * time.Second
@@ -70,6 +292,32 @@ func (c *Config) ApplyDefaults() {
 		c.MongoDB.Batch.ConcurrentRequest = 1
 	}
 
+	if c.MongoDB.Batch.MaxInFlightBatches == 0 {
+		c.MongoDB.Batch.MaxInFlightBatches = 1
+	}
+
+	if c.MongoDB.Batch.Partitions == 0 {
+		c.MongoDB.Batch.Partitions = 1
+	}
+
+	if c.MongoDB.Batch.Adaptive.Enabled {
+		c.MongoDB.Batch.Adaptive.applyDefaults(c.MongoDB.Batch.SizeLimit, c.MongoDB.Batch.ConcurrentRequest)
+	}
+
+	if c.MongoDB.DryRun.Enabled && c.MongoDB.DryRun.Sink == "" {
+		c.MongoDB.DryRun.Sink = DryRunSinkLog
+	}
+
+	for name, collectionOptions := range c.MongoDB.CollectionOptions {
+		if collectionOptions.SCD.Enabled {
+			collectionOptions.SCD.applyDefaults()
+		}
+		if collectionOptions.Schema.IsEnabled() {
+			collectionOptions.Schema.applyDefaults()
+		}
+		c.MongoDB.CollectionOptions[name] = collectionOptions
+	}
+
 	if c.MongoDB.ConnectionPool.MaxPoolSize == 0 {
 		c.MongoDB.ConnectionPool.MaxPoolSize = 100
 	}
@@ -97,6 +345,80 @@ func (c *Config) ApplyDefaults() {
 	if c.MongoDB.Timeouts.BulkRequestTimeoutMS == 0 {
 		c.MongoDB.Timeouts.BulkRequestTimeoutMS = 30000 // 30 seconds
 	}
+
+	if c.MongoDB.Health.PingTimeout == 0 {
+		c.MongoDB.Health.PingTimeout = 5 * time.Second
+	}
+
+	if c.MongoDB.Health.MaxFlushAge == 0 {
+		c.MongoDB.Health.MaxFlushAge = 3 * c.MongoDB.Batch.TickerDuration
+	}
+
+	if c.MongoDB.Transaction.Scope != "" && c.MongoDB.Transaction.Timeout == 0 {
+		c.MongoDB.Transaction.Timeout = 30 * time.Second
+	}
+
+	if c.MongoDB.Admin.Port == 0 {
+		c.MongoDB.Admin.Port = 8081
+	}
+
+	if c.MongoDB.Admin.Host == "" {
+		c.MongoDB.Admin.Host = "127.0.0.1"
+	}
+}
+
+func (s *SchemaOptions) applyDefaults() {
+	if s.Policy == "" {
+		s.Policy = SchemaPolicyDeadLetter
+	}
+
+	if s.FlagField == "" {
+		s.FlagField = "_schemaErrors"
+	}
+}
+
+func (s *SCDOptions) applyDefaults() {
+	if s.ValidFromField == "" {
+		s.ValidFromField = "validFrom"
+	}
+
+	if s.ValidToField == "" {
+		s.ValidToField = "validTo"
+	}
+
+	if s.VersionField == "" {
+		s.VersionField = "version"
+	}
+}
+
+func (a *AdaptiveBatchConfig) applyDefaults(sizeLimit int, concurrentRequest int) {
+	if a.MinSizeLimit == 0 {
+		a.MinSizeLimit = max(sizeLimit/10, 1)
+	}
+
+	if a.MaxSizeLimit == 0 {
+		a.MaxSizeLimit = sizeLimit * 4
+	}
+
+	if a.MinConcurrentRequest == 0 {
+		a.MinConcurrentRequest = 1
+	}
+
+	if a.MaxConcurrentRequest == 0 {
+		a.MaxConcurrentRequest = concurrentRequest * 4
+	}
+
+	if a.TargetLatency == 0 {
+		a.TargetLatency = time.Second
+	}
+
+	if a.MaxErrorRate == 0 {
+		a.MaxErrorRate = 0.05
+	}
+
+	if a.Window == 0 {
+		a.Window = 10
+	}
 }
 
 func (c *Config) Validate() error {
@@ -115,10 +437,289 @@ func (m *MongoDB) Validate() error {
 		return fmt.Errorf("connection pool validation failed: %w", err)
 	}
 
+	if err := m.Driver.Validate(); err != nil {
+		return fmt.Errorf("driver validation failed: %w", err)
+	}
+
+	if err := m.Transaction.Validate(); err != nil {
+		return fmt.Errorf("transaction validation failed: %w", err)
+	}
+
 	if len(m.CollectionMapping) == 0 {
 		return fmt.Errorf("collectionMapping is required")
 	}
 
+	if err := m.DryRun.Validate(); err != nil {
+		return fmt.Errorf("dry run validation failed: %w", err)
+	}
+
+	if err := m.Batch.Validate(); err != nil {
+		return fmt.Errorf("batch validation failed: %w", err)
+	}
+
+	for collection, collectionOptions := range m.CollectionOptions {
+		if !m.isMappedCollection(collection) {
+			return fmt.Errorf("collectionOptions has options for %s which is not a collection in collectionMapping", collection)
+		}
+
+		if err := collectionOptions.Validate(); err != nil {
+			return fmt.Errorf("collection options validation failed for %s: %w", collection, err)
+		}
+
+		// the new version and the close of the previous one must apply together, or a document is left with two open versions
+		if collectionOptions.SCD.Enabled && m.Transaction.Scope == "" {
+			return fmt.Errorf("scd of collection %s requires transaction.scope to write version changes atomically", collection)
+		}
+	}
+
+	return nil
+}
+
+func (m *MongoDB) isMappedCollection(collection string) bool {
+	for _, mongoCollection := range m.CollectionMapping {
+		if mongoCollection == collection {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CollectionOptions) Validate() error {
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("maxRetries (%d) cannot be negative", c.MaxRetries)
+	}
+
+	switch c.DuplicateKeyPolicy {
+	case "", DuplicateKeyPolicyIgnore, DuplicateKeyPolicyOverwrite, DuplicateKeyPolicyDeadLetter, DuplicateKeyPolicyFail:
+	default:
+		return fmt.Errorf("unsupported duplicateKeyPolicy %q, supported policies are %s, %s, %s and %s", c.DuplicateKeyPolicy,
+			DuplicateKeyPolicyIgnore, DuplicateKeyPolicyOverwrite, DuplicateKeyPolicyDeadLetter, DuplicateKeyPolicyFail)
+	}
+
+	if err := c.Merge.Validate(); err != nil {
+		return fmt.Errorf("merge validation failed: %w", err)
+	}
+
+	if err := c.History.Validate(); err != nil {
+		return fmt.Errorf("history validation failed: %w", err)
+	}
+
+	if c.SCD.Enabled {
+		if err := c.SCD.Validate(); err != nil {
+			return fmt.Errorf("scd validation failed: %w", err)
+		}
+
+		if c.History.Enabled && (c.History.Only || c.History.Document == HistoryDocumentDiff) {
+			return fmt.Errorf("scd cannot be used with history only or diff documents")
+		}
+	}
+
+	if c.TimeSeries.Enabled {
+		if err := c.TimeSeries.Validate(); err != nil {
+			return fmt.Errorf("timeseries validation failed: %w", err)
+		}
+
+		if c.SCD.Enabled || c.Merge.Default || c.History.Document == HistoryDocumentDiff {
+			return fmt.Errorf("timeseries cannot be used with scd, merge default or history diff documents")
+		}
+
+		if c.Create.Capped || c.Create.Clustered {
+			return fmt.Errorf("timeseries collections cannot be capped or clustered")
+		}
+	}
+
+	if err := c.Schema.Validate(); err != nil {
+		return fmt.Errorf("schema validation failed: %w", err)
+	}
+
+	return c.validateProvisioning()
+}
+
+func (s *SchemaOptions) Validate() error {
+	if s.File != "" && s.Inline != nil {
+		return fmt.Errorf("file and inline cannot be used together")
+	}
+
+	switch s.Policy {
+	case "", SchemaPolicySkip, SchemaPolicyDeadLetter, SchemaPolicyFlag, SchemaPolicyHalt:
+	default:
+		return fmt.Errorf("unsupported policy %q, supported policies are %s, %s, %s and %s", s.Policy,
+			SchemaPolicySkip, SchemaPolicyDeadLetter, SchemaPolicyFlag, SchemaPolicyHalt)
+	}
+
+	return nil
+}
+
+func (c *CollectionOptions) validateProvisioning() error {
+	if err := c.Create.Validate(); err != nil {
+		return fmt.Errorf("create validation failed: %w", err)
+	}
+
+	for i := range c.Indexes {
+		if err := c.Indexes[i].Validate(); err != nil {
+			return fmt.Errorf("index %d validation failed: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *CreateOptions) Validate() error {
+	switch c.ValidationLevel {
+	case "", "off", "strict", "moderate":
+	default:
+		return fmt.Errorf("unsupported validationLevel %q, supported values are off, strict and moderate", c.ValidationLevel)
+	}
+
+	switch c.ValidationAction {
+	case "", "error", "warn":
+	default:
+		return fmt.Errorf("unsupported validationAction %q, supported values are error and warn", c.ValidationAction)
+	}
+
+	if c.Capped && c.SizeBytes <= 0 {
+		return fmt.Errorf("capped collections require a positive sizeBytes")
+	}
+
+	if !c.Capped && (c.SizeBytes != 0 || c.MaxDocuments != 0) {
+		return fmt.Errorf("sizeBytes and maxDocuments require capped")
+	}
+
+	if c.Capped && c.Clustered {
+		return fmt.Errorf("a collection cannot be both capped and clustered")
+	}
+
+	return nil
+}
+
+func (i *IndexOptions) Validate() error {
+	if len(i.Keys) == 0 {
+		return fmt.Errorf("keys are required")
+	}
+
+	for _, key := range i.Keys {
+		if err := key.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if i.ExpireAfter < 0 {
+		return fmt.Errorf("expireAfter (%v) cannot be negative", i.ExpireAfter)
+	}
+
+	if i.ExpireAfter > 0 && len(i.Keys) > 1 {
+		return fmt.Errorf("expireAfter requires a single key index")
+	}
+
+	return nil
+}
+
+func (k *IndexKey) Validate() error {
+	if k.Field == "" {
+		return fmt.Errorf("key field is required")
+	}
+
+	switch k.Type {
+	case "", IndexTypeText, IndexType2D, IndexType2DSphere, IndexTypeHashed:
+	default:
+		return fmt.Errorf("unsupported type %q of key %s, supported types are %s, %s, %s and %s",
+			k.Type, k.Field, IndexTypeText, IndexType2D, IndexType2DSphere, IndexTypeHashed)
+	}
+
+	if k.Direction != 0 && k.Direction != 1 && k.Direction != -1 {
+		return fmt.Errorf("direction (%d) of key %s must be 1 or -1", k.Direction, k.Field)
+	}
+
+	if k.Type != "" && k.Direction != 0 {
+		return fmt.Errorf("key %s cannot have both a type and a direction", k.Field)
+	}
+
+	return nil
+}
+
+// Value returns the value of the key in an index keys document.
+func (k *IndexKey) Value() any {
+	if k.Type != "" {
+		return k.Type
+	}
+
+	if k.Direction == -1 {
+		return -1
+	}
+
+	return 1
+}
+
+func (t *TimeSeriesOptions) Validate() error {
+	if t.TimeField == "" {
+		return fmt.Errorf("timeField is required")
+	}
+
+	if t.MetaField == t.TimeField {
+		return fmt.Errorf("metaField cannot be the timeField %q", t.TimeField)
+	}
+
+	switch t.Granularity {
+	case "", TimeSeriesGranularitySeconds, TimeSeriesGranularityMinutes, TimeSeriesGranularityHours:
+	default:
+		return fmt.Errorf("unsupported granularity %q, supported values are %s, %s and %s", t.Granularity,
+			TimeSeriesGranularitySeconds, TimeSeriesGranularityMinutes, TimeSeriesGranularityHours)
+	}
+
+	if t.ExpireAfter < 0 {
+		return fmt.Errorf("expireAfter (%v) cannot be negative", t.ExpireAfter)
+	}
+
+	return nil
+}
+
+func (s *SCDOptions) Validate() error {
+	fields := map[string]bool{"_id": true}
+	for _, field := range []string{s.ValidFromField, s.ValidToField, s.VersionField} {
+		if field == "" {
+			continue
+		}
+		if fields[field] {
+			return fmt.Errorf("field %q is used more than once or is _id", field)
+		}
+		fields[field] = true
+	}
+
+	return nil
+}
+
+func (h *HistoryOptions) Validate() error {
+	switch h.Document {
+	case "", HistoryDocumentFull, HistoryDocumentDiff:
+	default:
+		return fmt.Errorf("unsupported document %q, supported values are %s and %s", h.Document, HistoryDocumentFull, HistoryDocumentDiff)
+	}
+
+	if h.Document == HistoryDocumentDiff && h.Only {
+		return fmt.Errorf("diff document requires the current state to be written, it cannot be used with only")
+	}
+
+	if h.Retention < 0 {
+		return fmt.Errorf("retention (%v) cannot be negative", h.Retention)
+	}
+
+	return nil
+}
+
+func (m *MergeOptions) Validate() error {
+	switch m.NullFields {
+	case "", MergeNullFieldsSet, MergeNullFieldsUnset:
+	default:
+		return fmt.Errorf("unsupported nullFields %q, supported values are %s and %s",
+			m.NullFields, MergeNullFieldsSet, MergeNullFieldsUnset)
+	}
+
+	switch m.Arrays {
+	case "", MergeArraysReplace, MergeArraysAddToSet:
+	default:
+		return fmt.Errorf("unsupported arrays %q, supported values are %s and %s", m.Arrays, MergeArraysReplace, MergeArraysAddToSet)
+	}
+
 	return nil
 }
 
@@ -138,6 +739,96 @@ func (c *Connection) Validate() error {
 	return nil
 }
 
+func (b *BatchConfig) Validate() error {
+	if b.MaxInFlightBatches < 0 {
+		return fmt.Errorf("maxInFlightBatches (%d) cannot be negative", b.MaxInFlightBatches)
+	}
+
+	if b.Partitions < 0 {
+		return fmt.Errorf("partitions (%d) cannot be negative", b.Partitions)
+	}
+
+	if b.MaxBufferedDocuments < 0 {
+		return fmt.Errorf("maxBufferedDocuments (%d) cannot be negative", b.MaxBufferedDocuments)
+	}
+
+	if b.Adaptive.Enabled {
+		if err := b.Adaptive.Validate(); err != nil {
+			return fmt.Errorf("adaptive validation failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (a *AdaptiveBatchConfig) Validate() error {
+	if a.MinSizeLimit < 1 || a.MinSizeLimit > a.MaxSizeLimit {
+		return fmt.Errorf("minSizeLimit (%d) must be between 1 and maxSizeLimit (%d)", a.MinSizeLimit, a.MaxSizeLimit)
+	}
+
+	if a.MinConcurrentRequest < 1 || a.MinConcurrentRequest > a.MaxConcurrentRequest {
+		return fmt.Errorf("minConcurrentRequest (%d) must be between 1 and maxConcurrentRequest (%d)",
+			a.MinConcurrentRequest, a.MaxConcurrentRequest)
+	}
+
+	if a.MaxErrorRate < 0 || a.MaxErrorRate > 1 {
+		return fmt.Errorf("maxErrorRate (%v) must be between 0 and 1", a.MaxErrorRate)
+	}
+
+	return nil
+}
+
+func (d *Driver) Validate() error {
+	for _, compressor := range d.Compressors {
+		switch compressor {
+		case "zstd", "snappy", "zlib":
+		default:
+			return fmt.Errorf("unsupported compressor %q, supported compressors are zstd, snappy and zlib", compressor)
+		}
+	}
+
+	if d.HeartbeatIntervalMS != 0 && d.HeartbeatIntervalMS < 500 {
+		return fmt.Errorf("heartbeatIntervalMS (%d) cannot be less than 500", d.HeartbeatIntervalMS)
+	}
+
+	if d.LocalThresholdMS < 0 {
+		return fmt.Errorf("localThresholdMS (%d) cannot be negative", d.LocalThresholdMS)
+	}
+
+	if d.DirectConnection && d.ReplicaSet != "" {
+		return fmt.Errorf("directConnection cannot be used together with replicaSet")
+	}
+
+	return nil
+}
+
+func (t *Transaction) Validate() error {
+	switch t.Scope {
+	case "", TransactionScopeEvent, TransactionScopeBatch:
+	default:
+		return fmt.Errorf("unsupported scope %q, supported scopes are %s and %s", t.Scope, TransactionScopeEvent, TransactionScopeBatch)
+	}
+
+	return nil
+}
+
+func (d *DryRun) Validate() error {
+	switch d.Sink {
+	case "", DryRunSinkLog:
+		if d.File != "" {
+			return fmt.Errorf("file is only used by the %s sink", DryRunSinkFile)
+		}
+	case DryRunSinkFile:
+		if isEmpty(d.File) {
+			return fmt.Errorf("file is required for the %s sink", DryRunSinkFile)
+		}
+	default:
+		return fmt.Errorf("unsupported sink %q, supported sinks are %s and %s", d.Sink, DryRunSinkLog, DryRunSinkFile)
+	}
+
+	return nil
+}
+
 func (cp *ConnectionPool) Validate() error {
 	if cp.MinPoolSize > cp.MaxPoolSize {
 		return fmt.Errorf("minPoolSize (%d) cannot be greater than maxPoolSize (%d)",
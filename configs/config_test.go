@@ -22,10 +22,12 @@ func TestConfig_ApplyDefaults(t *testing.T) {
 			expected: &Config{
 				MongoDB: MongoDB{
 					Batch: BatchConfig{
-						TickerDuration:    10 * time.Second,
-						SizeLimit:         1000,
-						ByteSizeLimit:     helpers.ResolveUnionIntOrStringValue("10mb"),
-						ConcurrentRequest: 1,
+						TickerDuration:     10 * time.Second,
+						SizeLimit:          1000,
+						ByteSizeLimit:      helpers.ResolveUnionIntOrStringValue("10mb"),
+						ConcurrentRequest:  1,
+						MaxInFlightBatches: 1,
+						Partitions:         1,
 					},
 					ConnectionPool: ConnectionPool{
 						MaxPoolSize:   100,
@@ -38,6 +40,14 @@ func TestConfig_ApplyDefaults(t *testing.T) {
 						SocketTimeoutMS:          30000,
 						BulkRequestTimeoutMS:     30000,
 					},
+					Admin: Admin{
+						Host: "127.0.0.1",
+						Port: 8081,
+					},
+					Health: Health{
+						PingTimeout: 5 * time.Second,
+						MaxFlushAge: 30 * time.Second,
+					},
 				},
 			},
 		},
@@ -46,9 +56,12 @@ func TestConfig_ApplyDefaults(t *testing.T) {
 			config: &Config{
 				MongoDB: MongoDB{
 					Batch: BatchConfig{
-						TickerDuration:    5 * time.Second,
-						SizeLimit:         500,
-						ConcurrentRequest: 2,
+						TickerDuration:     5 * time.Second,
+						SizeLimit:          500,
+						ConcurrentRequest:  2,
+						MaxInFlightBatches: 3,
+						Partitions:         4,
+						Adaptive:           AdaptiveBatchConfig{Enabled: true, MaxSizeLimit: 1500},
 					},
 					ConnectionPool: ConnectionPool{
 						MaxPoolSize:   50,
@@ -61,15 +74,32 @@ func TestConfig_ApplyDefaults(t *testing.T) {
 						SocketTimeoutMS:          15000,
 						BulkRequestTimeoutMS:     20000,
 					},
+					Transaction: Transaction{Scope: TransactionScopeEvent},
+					Admin: Admin{
+						Host: "0.0.0.0",
+						Port: 9090,
+					},
 				},
 			},
 			expected: &Config{
 				MongoDB: MongoDB{
 					Batch: BatchConfig{
-						TickerDuration:    5 * time.Second,
-						SizeLimit:         500,
-						ByteSizeLimit:     helpers.ResolveUnionIntOrStringValue("10mb"),
-						ConcurrentRequest: 2,
+						TickerDuration:     5 * time.Second,
+						SizeLimit:          500,
+						ByteSizeLimit:      helpers.ResolveUnionIntOrStringValue("10mb"),
+						ConcurrentRequest:  2,
+						MaxInFlightBatches: 3,
+						Partitions:         4,
+						Adaptive: AdaptiveBatchConfig{
+							Enabled:              true,
+							MinSizeLimit:         50,
+							MaxSizeLimit:         1500,
+							MinConcurrentRequest: 1,
+							MaxConcurrentRequest: 8,
+							TargetLatency:        time.Second,
+							MaxErrorRate:         0.05,
+							Window:               10,
+						},
 					},
 					ConnectionPool: ConnectionPool{
 						MaxPoolSize:   50,
@@ -82,6 +112,15 @@ func TestConfig_ApplyDefaults(t *testing.T) {
 						SocketTimeoutMS:          15000,
 						BulkRequestTimeoutMS:     20000,
 					},
+					Transaction: Transaction{Scope: TransactionScopeEvent, Timeout: 30 * time.Second},
+					Admin: Admin{
+						Host: "0.0.0.0",
+						Port: 9090,
+					},
+					Health: Health{
+						PingTimeout: 5 * time.Second,
+						MaxFlushAge: 15 * time.Second,
+					},
 				},
 			},
 		},
@@ -93,6 +132,9 @@ func TestConfig_ApplyDefaults(t *testing.T) {
 			assert.Equal(t, tt.expected.MongoDB.Batch.TickerDuration, tt.config.MongoDB.Batch.TickerDuration)
 			assert.Equal(t, tt.expected.MongoDB.Batch.SizeLimit, tt.config.MongoDB.Batch.SizeLimit)
 			assert.Equal(t, tt.expected.MongoDB.Batch.ConcurrentRequest, tt.config.MongoDB.Batch.ConcurrentRequest)
+			assert.Equal(t, tt.expected.MongoDB.Batch.MaxInFlightBatches, tt.config.MongoDB.Batch.MaxInFlightBatches)
+			assert.Equal(t, tt.expected.MongoDB.Batch.Partitions, tt.config.MongoDB.Batch.Partitions)
+			assert.Equal(t, tt.expected.MongoDB.Batch.Adaptive, tt.config.MongoDB.Batch.Adaptive)
 			assert.Equal(t, tt.expected.MongoDB.ConnectionPool.MaxPoolSize, tt.config.MongoDB.ConnectionPool.MaxPoolSize)
 			assert.Equal(t, tt.expected.MongoDB.ConnectionPool.MinPoolSize, tt.config.MongoDB.ConnectionPool.MinPoolSize)
 			assert.Equal(t, tt.expected.MongoDB.ConnectionPool.MaxIdleTimeMS, tt.config.MongoDB.ConnectionPool.MaxIdleTimeMS)
@@ -100,10 +142,55 @@ func TestConfig_ApplyDefaults(t *testing.T) {
 			assert.Equal(t, tt.expected.MongoDB.Timeouts.ServerSelectionTimeoutMS, tt.config.MongoDB.Timeouts.ServerSelectionTimeoutMS)
 			assert.Equal(t, tt.expected.MongoDB.Timeouts.SocketTimeoutMS, tt.config.MongoDB.Timeouts.SocketTimeoutMS)
 			assert.Equal(t, tt.expected.MongoDB.Timeouts.BulkRequestTimeoutMS, tt.config.MongoDB.Timeouts.BulkRequestTimeoutMS)
+			assert.Equal(t, tt.expected.MongoDB.Admin.Port, tt.config.MongoDB.Admin.Port)
+			assert.Equal(t, tt.expected.MongoDB.Admin.Host, tt.config.MongoDB.Admin.Host)
+			assert.Equal(t, tt.expected.MongoDB.Transaction, tt.config.MongoDB.Transaction)
+			assert.Equal(t, tt.expected.MongoDB.Health.PingTimeout, tt.config.MongoDB.Health.PingTimeout)
+			assert.Equal(t, tt.expected.MongoDB.Health.MaxFlushAge, tt.config.MongoDB.Health.MaxFlushAge)
 		})
 	}
 }
 
+func TestConfig_ApplyDefaults_SCD(t *testing.T) {
+	config := &Config{
+		MongoDB: MongoDB{
+			CollectionOptions: map[string]CollectionOptions{
+				"versioned": {SCD: SCDOptions{Enabled: true, VersionField: "revision"}},
+				"plain":     {},
+			},
+		},
+	}
+
+	config.ApplyDefaults()
+
+	assert.Equal(t, SCDOptions{Enabled: true, ValidFromField: "validFrom", ValidToField: "validTo", VersionField: "revision"},
+		config.MongoDB.CollectionOptions["versioned"].SCD)
+	assert.Equal(t, SCDOptions{}, config.MongoDB.CollectionOptions["plain"].SCD)
+}
+
+func TestConfig_ApplyDefaults_Schema(t *testing.T) {
+	config := &Config{
+		MongoDB: MongoDB{
+			CollectionOptions: map[string]CollectionOptions{
+				"validated": {Schema: SchemaOptions{File: "schema.json"}},
+			},
+		},
+	}
+
+	config.ApplyDefaults()
+
+	assert.Equal(t, SchemaOptions{File: "schema.json", Policy: SchemaPolicyDeadLetter, FlagField: "_schemaErrors"},
+		config.MongoDB.CollectionOptions["validated"].Schema)
+}
+
+func TestConfig_ApplyDefaults_DryRun(t *testing.T) {
+	config := &Config{MongoDB: MongoDB{DryRun: DryRun{Enabled: true}}}
+
+	config.ApplyDefaults()
+
+	assert.Equal(t, DryRun{Enabled: true, Sink: DryRunSinkLog}, config.MongoDB.DryRun)
+}
+
 func TestConfig_Validate(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -228,6 +315,331 @@ func TestMongoDB_Validate(t *testing.T) {
 			expectErr: true,
 			errMsg:    "collectionMapping is required",
 		},
+		{
+			name: "collection options for unmapped collection",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"othercollection": {Ordered: true},
+				},
+			},
+			expectErr: true,
+			errMsg:    "collectionOptions has options for othercollection which is not a collection in collectionMapping",
+		},
+		{
+			name: "negative collection maxRetries",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"testcollection": {Ordered: true, MaxRetries: -1},
+				},
+			},
+			expectErr: true,
+			errMsg:    "maxRetries (-1) cannot be negative",
+		},
+		{
+			name: "unsupported merge arrays",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"testcollection": {Merge: MergeOptions{Default: true, Arrays: "concat"}},
+				},
+			},
+			expectErr: true,
+			errMsg:    `unsupported arrays "concat"`,
+		},
+		{
+			name: "unsupported duplicate key policy",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"testcollection": {DuplicateKeyPolicy: "skip"},
+				},
+			},
+			expectErr: true,
+			errMsg:    `unsupported duplicateKeyPolicy "skip"`,
+		},
+		{
+			name: "history diff with only",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"testcollection": {History: HistoryOptions{Enabled: true, Document: HistoryDocumentDiff, Only: true}},
+				},
+			},
+			expectErr: true,
+			errMsg:    "cannot be used with only",
+		},
+		{
+			name: "negative history retention",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"testcollection": {History: HistoryOptions{Enabled: true, Retention: -time.Hour}},
+				},
+			},
+			expectErr: true,
+			errMsg:    "retention (-1h0m0s) cannot be negative",
+		},
+		{
+			name: "scd with history only",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"testcollection": {SCD: SCDOptions{Enabled: true}, History: HistoryOptions{Enabled: true, Only: true}},
+				},
+			},
+			expectErr: true,
+			errMsg:    "scd cannot be used with history only or diff documents",
+		},
+		{
+			name: "scd field used twice",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"testcollection": {SCD: SCDOptions{Enabled: true, ValidFromField: "from", ValidToField: "from"}},
+				},
+			},
+			expectErr: true,
+			errMsg:    `field "from" is used more than once or is _id`,
+		},
+		{
+			name: "scd without transaction",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"testcollection": {SCD: SCDOptions{Enabled: true}},
+				},
+			},
+			expectErr: true,
+			errMsg:    "scd of collection testcollection requires transaction.scope",
+		},
+		{
+			name: "scd with transaction",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"testcollection": {SCD: SCDOptions{Enabled: true}},
+				},
+				Transaction: Transaction{Scope: TransactionScopeEvent},
+			},
+		},
+		{
+			name: "timeseries without time field",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"testcollection": {TimeSeries: TimeSeriesOptions{Enabled: true}},
+				},
+			},
+			expectErr: true,
+			errMsg:    "timeField is required",
+		},
+		{
+			name: "unsupported timeseries granularity",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"testcollection": {TimeSeries: TimeSeriesOptions{Enabled: true, TimeField: "ts", Granularity: "days"}},
+				},
+			},
+			expectErr: true,
+			errMsg:    `unsupported granularity "days"`,
+		},
+		{
+			name: "timeseries with scd",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"testcollection": {TimeSeries: TimeSeriesOptions{Enabled: true, TimeField: "ts"}, SCD: SCDOptions{Enabled: true}},
+				},
+			},
+			expectErr: true,
+			errMsg:    "timeseries cannot be used with scd",
+		},
+		{
+			name: "capped collection without size",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"testcollection": {Create: CreateOptions{Capped: true}},
+				},
+			},
+			expectErr: true,
+			errMsg:    "capped collections require a positive sizeBytes",
+		},
+		{
+			name: "index without keys",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"testcollection": {Indexes: []IndexOptions{{Unique: true}}},
+				},
+			},
+			expectErr: true,
+			errMsg:    "index 0 validation failed: keys are required",
+		},
+		{
+			name: "ttl index with multiple keys",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"testcollection": {Indexes: []IndexOptions{{
+						Keys:        []IndexKey{{Field: "a"}, {Field: "b"}},
+						ExpireAfter: time.Hour,
+					}}},
+				},
+			},
+			expectErr: true,
+			errMsg:    "expireAfter requires a single key index",
+		},
+		{
+			name: "index key with type and direction",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"testcollection": {Indexes: []IndexOptions{{Keys: []IndexKey{{Field: "a", Type: IndexTypeHashed, Direction: 1}}}}},
+				},
+			},
+			expectErr: true,
+			errMsg:    "key a cannot have both a type and a direction",
+		},
+		{
+			name: "schema file and inline",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"testcollection": {Schema: SchemaOptions{File: "schema.json", Inline: map[string]any{"type": "object"}}},
+				},
+			},
+			expectErr: true,
+			errMsg:    "file and inline cannot be used together",
+		},
+		{
+			name: "unsupported schema policy",
+			mongodb: &MongoDB{
+				Connection: Connection{
+					URI:      "mongodb://localhost:27017",
+					Database: "testdb",
+				},
+				CollectionMapping: map[string]string{
+					"_default": "testcollection",
+				},
+				CollectionOptions: map[string]CollectionOptions{
+					"testcollection": {Schema: SchemaOptions{File: "schema.json", Policy: "drop"}},
+				},
+			},
+			expectErr: true,
+			errMsg:    `unsupported policy "drop"`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -321,6 +733,209 @@ func TestConnection_Validate(t *testing.T) {
 	}
 }
 
+func TestBatchConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		batchConfig *BatchConfig
+		expectErr   bool
+		errMsg      string
+	}{
+		{
+			name:        "valid batch config",
+			batchConfig: &BatchConfig{MaxInFlightBatches: 2},
+			expectErr:   false,
+		},
+		{
+			name:        "negative maxInFlightBatches",
+			batchConfig: &BatchConfig{MaxInFlightBatches: -1},
+			expectErr:   true,
+			errMsg:      "maxInFlightBatches (-1) cannot be negative",
+		},
+		{
+			name:        "negative partitions",
+			batchConfig: &BatchConfig{Partitions: -2},
+			expectErr:   true,
+			errMsg:      "partitions (-2) cannot be negative",
+		},
+		{
+			name:        "negative maxBufferedDocuments",
+			batchConfig: &BatchConfig{MaxBufferedDocuments: -1},
+			expectErr:   true,
+			errMsg:      "maxBufferedDocuments (-1) cannot be negative",
+		},
+		{
+			name: "valid adaptive config",
+			batchConfig: &BatchConfig{Adaptive: AdaptiveBatchConfig{
+				Enabled: true, MinSizeLimit: 10, MaxSizeLimit: 100, MinConcurrentRequest: 1, MaxConcurrentRequest: 4,
+			}},
+			expectErr: false,
+		},
+		{
+			name: "adaptive minSizeLimit > maxSizeLimit",
+			batchConfig: &BatchConfig{Adaptive: AdaptiveBatchConfig{
+				Enabled: true, MinSizeLimit: 200, MaxSizeLimit: 100, MinConcurrentRequest: 1, MaxConcurrentRequest: 4,
+			}},
+			expectErr: true,
+			errMsg:    "minSizeLimit (200) must be between 1 and maxSizeLimit (100)",
+		},
+		{
+			name: "adaptive minConcurrentRequest > maxConcurrentRequest",
+			batchConfig: &BatchConfig{Adaptive: AdaptiveBatchConfig{
+				Enabled: true, MinSizeLimit: 10, MaxSizeLimit: 100, MinConcurrentRequest: 5, MaxConcurrentRequest: 4,
+			}},
+			expectErr: true,
+			errMsg:    "minConcurrentRequest (5) must be between 1 and maxConcurrentRequest (4)",
+		},
+		{
+			name:        "disabled adaptive config is not validated",
+			batchConfig: &BatchConfig{Adaptive: AdaptiveBatchConfig{MinSizeLimit: 200, MaxSizeLimit: 100}},
+			expectErr:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.batchConfig.Validate()
+			if tt.expectErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDriver_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		driver    *Driver
+		expectErr bool
+		errMsg    string
+	}{
+		{
+			name: "valid driver config",
+			driver: &Driver{
+				Compressors:         []string{"zstd", "snappy", "zlib"},
+				HeartbeatIntervalMS: 10000,
+				LocalThresholdMS:    15,
+				ReplicaSet:          "rs0",
+			},
+			expectErr: false,
+		},
+		{
+			name:      "unsupported compressor",
+			driver:    &Driver{Compressors: []string{"gzip"}},
+			expectErr: true,
+			errMsg:    `unsupported compressor "gzip"`,
+		},
+		{
+			name:      "heartbeat interval too short",
+			driver:    &Driver{HeartbeatIntervalMS: 100},
+			expectErr: true,
+			errMsg:    "heartbeatIntervalMS (100) cannot be less than 500",
+		},
+		{
+			name:      "negative local threshold",
+			driver:    &Driver{LocalThresholdMS: -1},
+			expectErr: true,
+			errMsg:    "localThresholdMS (-1) cannot be negative",
+		},
+		{
+			name:      "direct connection with replica set",
+			driver:    &Driver{DirectConnection: true, ReplicaSet: "rs0"},
+			expectErr: true,
+			errMsg:    "directConnection cannot be used together with replicaSet",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.driver.Validate()
+			if tt.expectErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestTransaction_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		transaction *Transaction
+		expectErr   bool
+		errMsg      string
+	}{
+		{name: "disabled", transaction: &Transaction{}},
+		{name: "event scope", transaction: &Transaction{Scope: TransactionScopeEvent}},
+		{name: "batch scope", transaction: &Transaction{Scope: TransactionScopeBatch}},
+		{
+			name:        "unsupported scope",
+			transaction: &Transaction{Scope: "collection"},
+			expectErr:   true,
+			errMsg:      `unsupported scope "collection"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.transaction.Validate()
+			if tt.expectErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDryRun_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		dryRun    *DryRun
+		expectErr bool
+		errMsg    string
+	}{
+		{name: "disabled", dryRun: &DryRun{}},
+		{name: "log sink", dryRun: &DryRun{Enabled: true, Sink: DryRunSinkLog, Commit: true}},
+		{name: "file sink", dryRun: &DryRun{Enabled: true, Sink: DryRunSinkFile, File: "writes.jsonl"}},
+		{
+			name:      "file sink without file",
+			dryRun:    &DryRun{Enabled: true, Sink: DryRunSinkFile},
+			expectErr: true,
+			errMsg:    "file is required for the file sink",
+		},
+		{
+			name:      "file with log sink",
+			dryRun:    &DryRun{Enabled: true, Sink: DryRunSinkLog, File: "writes.jsonl"},
+			expectErr: true,
+			errMsg:    "file is only used by the file sink",
+		},
+		{
+			name:      "unsupported sink",
+			dryRun:    &DryRun{Enabled: true, Sink: "kafka"},
+			expectErr: true,
+			errMsg:    `unsupported sink "kafka"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.dryRun.Validate()
+			if tt.expectErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
 func TestConnectionPool_Validate(t *testing.T) {
 	tests := []struct {
 		name           string
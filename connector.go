@@ -1,19 +1,33 @@
 package dcpmongodb
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	godcp "github.com/Trendyol/go-dcp"
+	"github.com/Trendyol/go-dcp-mongodb/admin"
 	config "github.com/Trendyol/go-dcp-mongodb/configs"
 	"github.com/Trendyol/go-dcp-mongodb/couchbase"
+	"github.com/Trendyol/go-dcp-mongodb/mongodb"
 	"github.com/Trendyol/go-dcp-mongodb/mongodb/bulk"
+	"github.com/Trendyol/go-dcp-mongodb/verify"
+	dcpcouchbase "github.com/Trendyol/go-dcp/couchbase"
 	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/metadata"
 	"github.com/Trendyol/go-dcp/models"
 	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
 	yamlv3 "gopkg.in/yaml.v3"
 )
 
@@ -23,56 +37,213 @@ type Connector interface {
 	GetDcpClient() interface{}
 }
 
+// Controller is implemented by the connectors Build returns. It is kept apart from Connector so existing
+// implementations of Connector keep compiling, get it with a type assertion:
+//
+//	controller, ok := connector.(dcpmongodb.Controller)
+type Controller interface {
+	Connector
+	StartWithContext(ctx context.Context) error
+	Snapshot(ctx context.Context) (SnapshotResult, error)
+	Shutdown(ctx context.Context) error
+	Pause()
+	Resume()
+	Flush(ctx context.Context) error
+	Status() bulk.Status
+	Health(ctx context.Context) admin.Health
+	AdminHandler() http.Handler
+}
+
 type connector struct {
-	dcp    godcp.Dcp
-	mapper Mapper
-	config *config.Config
-	bulk   *bulk.Bulk
+	startTime        time.Time
+	dcp              godcp.Dcp
+	mapper           Mapper
+	config           *config.Config
+	bulk             *bulk.Bulk
+	adminServer      *admin.Server
+	fatalErr         error
+	snapshotErr      error
+	snapshotResult   *SnapshotResult
+	signals          chan os.Signal
+	fatalLock        sync.Mutex
+	snapshotLock     sync.Mutex
+	closeOnce        sync.Once
+	isDcpReady       atomic.Bool
+	isRebalancing    atomic.Bool
+	isCloseRequested atomic.Bool
 }
 
 func (c *connector) Start() {
+	if err := c.StartWithContext(context.Background()); err != nil {
+		logger.Log.Error("connector stopped with error: %v", err)
+	}
+}
+
+// StartWithContext blocks until the context is cancelled, the connector is closed or the bulk fails
+// with an unrecoverable error, which is then returned. Call Shutdown afterwards to drain the batch.
+// In the finite dcp mode it also returns once the streams reached their end, see Snapshot.
+func (c *connector) StartWithContext(ctx context.Context) error {
+	c.startTime = time.Now()
+
+	if c.dcp.GetConfig().IsDcpModeFinite() {
+		// go-dcp closes the streams on these signals too, they must not be taken for the end of the snapshot
+		c.signals = make(chan os.Signal, 1)
+		signal.Notify(c.signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGABRT, syscall.SIGQUIT)
+		defer signal.Stop(c.signals)
+	}
+
+	if c.config.MongoDB.Admin.Enabled {
+		c.adminServer = admin.NewServer(c.config.MongoDB.Admin.Host, c.config.MongoDB.Admin.Port, c.AdminHandler())
+		go c.adminServer.Listen()
+	}
+
 	go func() {
 		<-c.dcp.WaitUntilReady()
+		c.isDcpReady.Store(true)
 		c.bulk.StartBulk()
 	}()
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	go func() {
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			c.closeDcp()
+		case err := <-c.bulk.Errors():
+			c.fatalLock.Lock()
+			c.fatalErr = err
+			c.fatalLock.Unlock()
+			c.closeDcp()
+		}
+	}()
+
 	c.dcp.Start()
+
+	c.fatalLock.Lock()
+	defer c.fatalLock.Unlock()
+	if c.fatalErr != nil {
+		return c.fatalErr
+	}
+
+	c.snapshotLock.Lock()
+	defer c.snapshotLock.Unlock()
+	if c.snapshotErr != nil {
+		return fmt.Errorf("snapshot flush failed, uncommitted messages will be reprocessed: %w", c.snapshotErr)
+	}
+
+	return nil
+}
+
+func (c *connector) closeDcp() {
+	c.closeOnce.Do(func() {
+		c.isCloseRequested.Store(true)
+		c.isDcpReady.Store(false)
+		c.dcp.Close()
+	})
 }
 
 func (c *connector) Close() {
-	c.dcp.Close()
-	c.bulk.Close()
+	if err := c.Shutdown(context.Background()); err != nil {
+		logger.Log.Error("error while closing connector: %v", err)
+	}
+}
+
+// Shutdown stops the dcp stream, then flushes and commits the remaining batch and disconnects
+// from MongoDB, giving up on the drain when the context is done.
+func (c *connector) Shutdown(ctx context.Context) error {
+	c.closeDcp()
+	err := c.bulk.Shutdown(ctx)
+
+	if c.adminServer != nil {
+		c.adminServer.Shutdown()
+	}
+
+	return err
 }
 
 func (c *connector) GetDcpClient() interface{} {
 	return c.dcp.GetClient()
 }
 
-func (c *connector) listener(ctx *models.ListenerContext) {
-	var e couchbase.Event
-	switch event := ctx.Event.(type) {
-	case models.DcpMutation:
-		e = couchbase.NewMutateEvent(event.Key, event.Value, event.CollectionName, event.EventTime, event.Cas, event.VbID)
-	case models.DcpExpiration:
-		e = couchbase.NewExpireEvent(event.Key, nil, event.CollectionName, event.EventTime, event.Cas, event.VbID)
-	case models.DcpDeletion:
-		e = couchbase.NewDeleteEvent(event.Key, nil, event.CollectionName, event.EventTime, event.Cas, event.VbID)
-	default:
-		return
+func (c *connector) Pause() {
+	c.bulk.Pause()
+}
+
+func (c *connector) Resume() {
+	c.bulk.Resume()
+}
+
+func (c *connector) Flush(ctx context.Context) error {
+	return c.bulk.ForceFlush(ctx)
+}
+
+func (c *connector) Status() bulk.Status {
+	return c.bulk.Status()
+}
+
+func (c *connector) Health(ctx context.Context) admin.Health {
+	health := admin.Health{
+		DcpReady:      c.isDcpReady.Load(),
+		BulkAlive:     c.bulk.IsAlive(),
+		LastFlushTime: c.bulk.LastFlushTime(),
 	}
 
-	actions := c.mapper(e)
+	pingCtx, cancel := context.WithTimeout(ctx, c.config.MongoDB.Health.PingTimeout)
+	defer cancel()
+
+	if err := c.bulk.Ping(pingCtx); err != nil {
+		health.MongoDBError = err.Error()
+	} else {
+		health.MongoDB = true
+	}
+
+	isFlushRecent := false
+	if !health.LastFlushTime.IsZero() {
+		sinceLastFlush := time.Since(health.LastFlushTime)
+		health.SinceLastFlush = sinceLastFlush.String()
+		isFlushRecent = sinceLastFlush <= c.config.MongoDB.Health.MaxFlushAge
+	}
+
+	health.Live = health.BulkAlive || !health.DcpReady
+	health.Ready = health.DcpReady && health.BulkAlive && health.MongoDB && isFlushRecent
+
+	return health
+}
 
-	if len(actions) == 0 {
-		ctx.Ack()
+func (c *connector) AdminHandler() http.Handler {
+	return admin.RequireToken(c.config.MongoDB.Admin.Token, admin.NewHandler(c))
+}
+
+// ConsumeEvent and TrackOffset make the connector the dcp consumer, so the bulk sees every offset go-dcp tracks.
+func (c *connector) ConsumeEvent(ctx *models.ListenerContext) {
+	c.listener(ctx)
+}
+
+func (c *connector) TrackOffset(vbID uint16, offset *models.Offset) {
+	c.bulk.TrackOffset(vbID, offset)
+}
+
+func (c *connector) listener(ctx *models.ListenerContext) {
+	e, ok := couchbase.NewEvent(ctx.Event)
+	if !ok {
 		return
 	}
 
-	c.bulk.AddActions(ctx, e.EventTime, actions, e.CollectionName)
+	actions := c.mapper(e)
+
+	// events without actions still go through the bulk, acking them right away could
+	// move the checkpoint past buffered events of the same vbucket
+	c.bulk.AddActions(ctx, e.EventTime, actions, e.CollectionName, e.VbID)
 }
 
 type ConnectorBuilder struct {
-	mapper Mapper
-	config any
+	mapper      Mapper
+	config      any
+	mongoClient *mongo.Client
+	sink        bulk.WriteSink
+	hooks       mongodb.Hooks
 }
 
 func newConnectorConfigFromPath(path string) (*config.Config, error) {
@@ -124,7 +295,7 @@ func newConfig(cf any) (*config.Config, error) {
 	}
 }
 
-func newConnector(cf any, mapper Mapper) (Connector, error) {
+func newValidConfig(cf any) (*config.Config, error) {
 	cfg, err := newConfig(cf)
 	if err != nil {
 		return nil, err
@@ -136,12 +307,21 @@ func newConnector(cf any, mapper Mapper) (Connector, error) {
 		return nil, err
 	}
 
+	return cfg, nil
+}
+
+func newConnector(cf any, mapper Mapper, mongoClient *mongo.Client, hooks mongodb.Hooks, sink bulk.WriteSink) (Connector, error) {
+	cfg, err := newValidConfig(cf)
+	if err != nil {
+		return nil, err
+	}
+
 	connector := &connector{
 		mapper: mapper,
 		config: cfg,
 	}
 
-	dcp, err := godcp.NewDcp(&cfg.Dcp, connector.listener)
+	dcp, err := godcp.NewExtendedDcp(&cfg.Dcp, connector)
 	if err != nil {
 		logger.Log.Error("Dcp error: %v", err)
 		return nil, err
@@ -151,15 +331,35 @@ func newConnector(cf any, mapper Mapper) (Connector, error) {
 	dcpConfig.Checkpoint.Type = "manual"
 
 	connector.dcp = dcp
+	dcp.SetEventHandler(&streamEventHandler{connector: connector})
 
-	connector.bulk, err = bulk.NewBulk(cfg, dcp.Commit)
+	connector.bulk, err = bulk.NewBulk(cfg, dcp.Commit, mongoClient, hooks, sink)
 	if err != nil {
 		return nil, err
 	}
 
+	if dcpMetadata := newDcpMetadata(dcp); dcpMetadata != nil {
+		dcp.SetMetadata(connector.bulk.CheckpointMetadata(dcpMetadata))
+	}
+
 	return connector, nil
 }
 
+// newDcpMetadata creates the metadata go-dcp would create on Start, so the bulk can wrap it. Other metadata types are
+// left to go-dcp, which rejects them.
+func newDcpMetadata(dcp godcp.Dcp) metadata.Metadata {
+	dcpConfig := dcp.GetConfig()
+
+	switch {
+	case dcpConfig.IsCouchbaseMetadata():
+		return dcpcouchbase.NewCBMetadata(dcp.GetClient(), dcpConfig)
+	case dcpConfig.IsFileMetadata():
+		return metadata.NewFSMetadata(dcpConfig)
+	default:
+		return nil
+	}
+}
+
 func NewConnectorBuilder(config any) ConnectorBuilder {
 	return ConnectorBuilder{
 		config: config,
@@ -172,8 +372,57 @@ func (c ConnectorBuilder) SetMapper(mapper Mapper) ConnectorBuilder {
 	return c
 }
 
+// SetMongoClient makes the connector use a pre-configured client instead of creating one from the config.
+// The connector never disconnects a client supplied this way, its lifecycle stays with the caller.
+func (c ConnectorBuilder) SetMongoClient(mongoClient *mongo.Client) ConnectorBuilder {
+	c.mongoClient = mongoClient
+	return c
+}
+
+// SetOnBulkError registers a hook called when a bulk request to a collection fails as a whole.
+func (c ConnectorBuilder) SetOnBulkError(onBulkError func(ctx mongodb.BulkErrorContext)) ConnectorBuilder {
+	c.hooks.OnBulkError = onBulkError
+	return c
+}
+
+// SetOnDocumentFailed registers a hook called for every document MongoDB rejected in a bulk request.
+func (c ConnectorBuilder) SetOnDocumentFailed(onDocumentFailed func(ctx mongodb.DocumentFailedContext)) ConnectorBuilder {
+	c.hooks.OnDocumentFailed = onDocumentFailed
+	return c
+}
+
+// SetOnFlush registers a hook called after a batch is written to MongoDB.
+func (c ConnectorBuilder) SetOnFlush(onFlush func(ctx mongodb.FlushContext)) ConnectorBuilder {
+	c.hooks.OnFlush = onFlush
+	return c
+}
+
+// SetOnCommit registers a hook called after the dcp checkpoint is committed.
+func (c ConnectorBuilder) SetOnCommit(onCommit func(ctx mongodb.CommitContext)) ConnectorBuilder {
+	c.hooks.OnCommit = onCommit
+	return c
+}
+
+// SetDryRunSink runs the connector in dry run, sending the write models to sink instead of MongoDB, e.g. a
+// bulk.Recorder. Checkpoints are committed only when mongodb.dryRun.commit is set.
+func (c ConnectorBuilder) SetDryRunSink(sink bulk.WriteSink) ConnectorBuilder {
+	c.sink = sink
+	return c
+}
+
 func (c ConnectorBuilder) Build() (Connector, error) {
-	return newConnector(c.config, c.mapper)
+	return newConnector(c.config, c.mapper, c.mongoClient, c.hooks, c.sink)
+}
+
+// BuildVerifier builds a verifier comparing the documents the mapper maps from Couchbase with the documents in
+// MongoDB, with the config, mapper, client and hooks of the connector.
+func (c ConnectorBuilder) BuildVerifier(options verify.Options) (*verify.Verifier, error) {
+	cfg, err := newValidConfig(c.config)
+	if err != nil {
+		return nil, err
+	}
+
+	return verify.NewVerifier(cfg, c.mapper, c.mongoClient, c.hooks, options), nil
 }
 
 func (c ConnectorBuilder) SetLogger(logrus *logrus.Logger) ConnectorBuilder {
@@ -1,6 +1,10 @@
 package couchbase
 
-import "time"
+import (
+	"time"
+
+	"github.com/Trendyol/go-dcp/models"
+)
 
 type Event struct {
 	CollectionName string
@@ -55,3 +59,17 @@ func NewMutateEvent(
 		VbID:           vbID,
 	}
 }
+
+// NewEvent converts a dcp mutation, deletion or expiration to an Event, ok is false for any other dcp event.
+func NewEvent(dcpEvent interface{}) (event Event, ok bool) {
+	switch e := dcpEvent.(type) {
+	case models.DcpMutation:
+		return NewMutateEvent(e.Key, e.Value, e.CollectionName, e.EventTime, e.Cas, e.VbID), true
+	case models.DcpExpiration:
+		return NewExpireEvent(e.Key, nil, e.CollectionName, e.EventTime, e.Cas, e.VbID), true
+	case models.DcpDeletion:
+		return NewDeleteEvent(e.Key, nil, e.CollectionName, e.EventTime, e.Cas, e.VbID), true
+	default:
+		return Event{}, false
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+
+	dcpmongodb "github.com/Trendyol/go-dcp-mongodb"
+	"github.com/Trendyol/go-dcp-mongodb/verify"
+)
+
+func main() {
+	compareContent := flag.Bool("content", false, "compare the content of the documents")
+	repair := flag.Bool("repair", false, "repair the missing, extra and mismatched documents")
+	flag.Parse()
+
+	verifier, err := dcpmongodb.NewConnectorBuilder("config.yml").
+		BuildVerifier(verify.Options{CompareContent: *compareContent, Repair: *repair})
+	if err != nil {
+		panic(err)
+	}
+
+	report, err := verifier.Verify(context.Background())
+	if err != nil {
+		panic(err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		panic(err)
+	}
+
+	if !report.IsConsistent() {
+		os.Exit(1)
+	}
+}
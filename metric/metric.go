@@ -16,6 +16,14 @@ var (
 		[]string{"collection", "status"}, // status: success, error
 	)
 
+	matchedCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(helpers.Name, "mongodb_connector_matched_documents", "total"),
+			Help: "The total number of documents matched by update operations",
+		},
+		[]string{"collection"},
+	)
+
 	deleteCounter = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: prometheus.BuildFQName(helpers.Name, "mongodb_connector_delete_operations", "total"),
@@ -24,6 +32,22 @@ var (
 		[]string{"collection", "status"}, // status: success, error
 	)
 
+	duplicateKeyCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(helpers.Name, "mongodb_connector_duplicate_key_errors", "total"),
+			Help: "The total number of duplicate key errors",
+		},
+		[]string{"collection", "policy"}, // policy: ignore, overwrite, deadLetter, fail
+	)
+
+	schemaViolationCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(helpers.Name, "mongodb_connector_schema_violations", "total"),
+			Help: "The total number of documents failing schema validation",
+		},
+		[]string{"collection", "policy"}, // policy: skip, deadLetter, flag, halt
+	)
+
 	processLatencyGauge = promauto.NewGauge(
 		prometheus.GaugeOpts{
 			Name: prometheus.BuildFQName(helpers.Name, "mongodb_connector_latency_ms", "current"),
@@ -37,11 +61,46 @@ var (
 			Help: "Bulk request process latency in milliseconds",
 		},
 	)
+
+	batchSizeLimitGauge = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(helpers.Name, "mongodb_connector_batch_size_limit", "current"),
+			Help: "Effective batch size limit",
+		},
+	)
+
+	concurrentRequestGauge = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(helpers.Name, "mongodb_connector_concurrent_request", "current"),
+			Help: "Effective number of concurrent bulk requests",
+		},
+	)
+
+	bufferedDocumentsGauge = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(helpers.Name, "mongodb_connector_buffered_documents", "current"),
+			Help: "Documents buffered in current and in-flight batches",
+		},
+	)
+
+	bufferedBytesGauge = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(helpers.Name, "mongodb_connector_buffered_bytes", "current"),
+			Help: "BSON bytes buffered in current and in-flight batches",
+		},
+	)
+
+	backpressureBlockedCounter = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(helpers.Name, "mongodb_connector_backpressure_blocked_ms", "total"),
+			Help: "Time in milliseconds the listener was blocked by buffer limits",
+		},
+	)
 )
 
 type PrometheusMetricsRecorder struct{}
 
-func NewMetricsRecorder() mongodb.MetricsRecorder {
+func NewMetricsRecorder() mongodb.ExtendedMetricsRecorder {
 	return &PrometheusMetricsRecorder{}
 }
 
@@ -53,6 +112,10 @@ func (m *PrometheusMetricsRecorder) RecordUpdateError(collection string, count i
 	updateCounter.WithLabelValues(collection, "error").Add(float64(count))
 }
 
+func (m *PrometheusMetricsRecorder) RecordUpdateMatched(collection string, count int64) {
+	matchedCounter.WithLabelValues(collection).Add(float64(count))
+}
+
 func (m *PrometheusMetricsRecorder) RecordDeleteSuccess(collection string, count int64) {
 	deleteCounter.WithLabelValues(collection, "success").Add(float64(count))
 }
@@ -61,6 +124,14 @@ func (m *PrometheusMetricsRecorder) RecordDeleteError(collection string, count i
 	deleteCounter.WithLabelValues(collection, "error").Add(float64(count))
 }
 
+func (m *PrometheusMetricsRecorder) RecordDuplicateKey(collection string, policy string) {
+	duplicateKeyCounter.WithLabelValues(collection, policy).Inc()
+}
+
+func (m *PrometheusMetricsRecorder) RecordSchemaViolation(collection string, policy string) {
+	schemaViolationCounter.WithLabelValues(collection, policy).Inc()
+}
+
 func (m *PrometheusMetricsRecorder) RecordProcessLatency(latencyMs int64) {
 	processLatencyGauge.Set(float64(latencyMs))
 }
@@ -68,3 +139,23 @@ func (m *PrometheusMetricsRecorder) RecordProcessLatency(latencyMs int64) {
 func (m *PrometheusMetricsRecorder) RecordBulkRequestProcessLatency(latencyMs int64) {
 	bulkRequestProcessLatencyGauge.Set(float64(latencyMs))
 }
+
+func (m *PrometheusMetricsRecorder) RecordBatchSizeLimit(sizeLimit int64) {
+	batchSizeLimitGauge.Set(float64(sizeLimit))
+}
+
+func (m *PrometheusMetricsRecorder) RecordConcurrentRequest(concurrentRequest int64) {
+	concurrentRequestGauge.Set(float64(concurrentRequest))
+}
+
+func (m *PrometheusMetricsRecorder) RecordBufferedDocuments(count int64) {
+	bufferedDocumentsGauge.Set(float64(count))
+}
+
+func (m *PrometheusMetricsRecorder) RecordBufferedBytes(size int64) {
+	bufferedBytesGauge.Set(float64(size))
+}
+
+func (m *PrometheusMetricsRecorder) RecordBackpressureBlockedTime(blockedMs int64) {
+	backpressureBlockedCounter.Add(float64(blockedMs))
+}
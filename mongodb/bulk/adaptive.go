@@ -0,0 +1,116 @@
+package bulk
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	config "github.com/Trendyol/go-dcp-mongodb/configs"
+	"github.com/Trendyol/go-dcp-mongodb/mongodb"
+	"github.com/Trendyol/go-dcp/logger"
+)
+
+// adaptiveController tunes the effective batch size limit and concurrent request count from the latency
+// and document error rate of the last bulk requests. It halves the batch size and drops one concurrent
+// request when requests are slow or failing, and grows both step by step while requests stay well below
+// the target latency.
+type adaptiveController struct {
+	metricsRecorder mongodb.ExtendedMetricsRecorder
+	config          config.AdaptiveBatchConfig
+	totalLatency    time.Duration
+	sizeLimit       atomic.Int64
+	concurrency     atomic.Int64
+	requests        int
+	documents       int64
+	failures        int64
+	lock            sync.Mutex
+}
+
+func newAdaptiveController(
+	cfg config.AdaptiveBatchConfig, sizeLimit int, concurrency int, metricsRecorder mongodb.ExtendedMetricsRecorder,
+) *adaptiveController {
+	a := &adaptiveController{
+		config:          cfg,
+		metricsRecorder: metricsRecorder,
+	}
+	a.set(
+		clamp(sizeLimit, cfg.MinSizeLimit, cfg.MaxSizeLimit),
+		clamp(concurrency, cfg.MinConcurrentRequest, cfg.MaxConcurrentRequest),
+	)
+	return a
+}
+
+func (a *adaptiveController) SizeLimit() int {
+	return int(a.sizeLimit.Load())
+}
+
+func (a *adaptiveController) Concurrency() int {
+	return int(a.concurrency.Load())
+}
+
+func (a *adaptiveController) recordFailures(count int) {
+	a.lock.Lock()
+	a.failures += int64(count)
+	a.lock.Unlock()
+}
+
+// observe records a finished bulk request and adjusts the limits once a full window is collected.
+func (a *adaptiveController) observe(latency time.Duration, documents int, err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.requests++
+	a.totalLatency += latency
+	a.documents += int64(documents)
+	if err != nil {
+		a.failures += int64(documents)
+	}
+
+	if a.requests < a.config.Window {
+		return
+	}
+
+	averageLatency := a.totalLatency / time.Duration(a.requests)
+	errorRate := 0.0
+	if a.documents > 0 {
+		errorRate = float64(a.failures) / float64(a.documents)
+	}
+
+	a.requests, a.totalLatency, a.documents, a.failures = 0, 0, 0, 0
+
+	sizeLimit, concurrency := a.SizeLimit(), a.Concurrency()
+
+	switch {
+	case errorRate > a.config.MaxErrorRate || averageLatency > a.config.TargetLatency:
+		sizeLimit /= 2
+		concurrency--
+	case averageLatency < a.config.TargetLatency/2:
+		sizeLimit += max(sizeLimit/4, 1)
+		concurrency++
+	default:
+		return
+	}
+
+	sizeLimit = clamp(sizeLimit, a.config.MinSizeLimit, a.config.MaxSizeLimit)
+	concurrency = clamp(concurrency, a.config.MinConcurrentRequest, a.config.MaxConcurrentRequest)
+
+	if sizeLimit != a.SizeLimit() || concurrency != a.Concurrency() {
+		logger.Log.Debug(
+			"adaptive batch: latency %v, error rate %.3f, size limit %d -> %d, concurrent request %d -> %d",
+			averageLatency, errorRate, a.SizeLimit(), sizeLimit, a.Concurrency(), concurrency,
+		)
+	}
+
+	a.set(sizeLimit, concurrency)
+}
+
+func (a *adaptiveController) set(sizeLimit int, concurrency int) {
+	a.sizeLimit.Store(int64(sizeLimit))
+	a.concurrency.Store(int64(concurrency))
+	a.metricsRecorder.RecordBatchSizeLimit(int64(sizeLimit))
+	a.metricsRecorder.RecordConcurrentRequest(int64(concurrency))
+}
+
+func clamp(value int, minValue int, maxValue int) int {
+	return min(max(value, minValue), maxValue)
+}
@@ -0,0 +1,86 @@
+package bulk
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Trendyol/go-dcp/logger"
+)
+
+func (b *Bulk) isBufferFull() bool {
+	return (b.maxBufferedDocuments > 0 && b.bufferedDocuments >= b.maxBufferedDocuments) ||
+		(b.maxBufferedBytes > 0 && b.bufferedBytes >= b.maxBufferedBytes)
+}
+
+// waitForBuffer blocks the listener, and so DCP, while the documents buffered in current and in-flight batches
+// exceed maxBufferedDocuments or maxBufferedBytes. Buffered batches are handed to the writers right away so the
+// buffer drains without waiting for the batch tickers.
+func (b *Bulk) waitForBuffer() {
+	b.bufferLock.Lock()
+	isFull := b.isBufferFull() && !b.isBufferClosed
+	b.bufferLock.Unlock()
+
+	if !isFull {
+		return
+	}
+
+	startedTime := time.Now()
+	logger.Log.Debug("buffer limit reached, blocking until buffered batches are written")
+
+	for _, p := range b.partitions {
+		if !p.hasBuffered() {
+			continue
+		}
+		if _, err := p.handoff(b.writeCtx); err != nil && !errors.Is(err, errBulkClosed) {
+			b.reportError(err)
+		}
+	}
+
+	b.bufferLock.Lock()
+	for b.isBufferFull() && !b.isBufferClosed {
+		b.bufferCond.Wait()
+	}
+	b.bufferLock.Unlock()
+
+	b.metricsRecorder.RecordBackpressureBlockedTime(time.Since(startedTime).Milliseconds())
+}
+
+func (b *Bulk) addBuffered(documents int, bytes int) {
+	b.bufferLock.Lock()
+	defer b.bufferLock.Unlock()
+
+	b.bufferedDocuments += documents
+	b.bufferedBytes += bytes
+	b.recordBuffered()
+}
+
+// releaseBuffered is called once a batch leaves the writer, whether it is written or not.
+func (b *Bulk) releaseBuffered(documents int, bytes int) {
+	b.bufferLock.Lock()
+	defer b.bufferLock.Unlock()
+
+	b.bufferedDocuments -= documents
+	b.bufferedBytes -= bytes
+	b.recordBuffered()
+	b.bufferCond.Broadcast()
+}
+
+// closeBuffer releases the listeners blocked on the buffer, they find the bulk closed afterwards.
+func (b *Bulk) closeBuffer() {
+	b.bufferLock.Lock()
+	defer b.bufferLock.Unlock()
+
+	b.isBufferClosed = true
+	b.bufferCond.Broadcast()
+}
+
+func (b *Bulk) recordBuffered() {
+	b.metricsRecorder.RecordBufferedDocuments(int64(b.bufferedDocuments))
+	b.metricsRecorder.RecordBufferedBytes(int64(b.bufferedBytes))
+}
+
+func (p *partition) hasBuffered() bool {
+	p.flushLock.Lock()
+	defer p.flushLock.Unlock()
+	return p.batchSize > 0
+}
@@ -2,11 +2,12 @@ package bulk
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"slices"
 	"strings"
 
-	"github.com/bytedance/sonic"
-
 	"github.com/Trendyol/go-dcp-mongodb/metric"
 
 	config "github.com/Trendyol/go-dcp-mongodb/configs"
@@ -14,11 +15,13 @@ import (
 	"github.com/Trendyol/go-dcp-mongodb/mongodb/client"
 
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Trendyol/go-dcp/helpers"
 	"github.com/Trendyol/go-dcp/logger"
 	"github.com/Trendyol/go-dcp/models"
+	"github.com/santhosh-tekuri/jsonschema/v5"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -26,40 +29,134 @@ import (
 )
 
 type Bulk struct {
-	client              *mongo.Client
-	database            *mongo.Database
-	collectionMapping   map[string]string
-	dcpCheckpointCommit func()
-	batchTicker         *time.Ticker
-	batchCommitTicker   *time.Ticker
-	batchTickerDuration time.Duration
-	batchSize           int
-	batchSizeLimit      int
-	batchByteSizeLimit  int
-	batchByteSize       int
-	concurrentRequest   int
-	batch               []BatchItem
-	batchKeys           map[string]int
-	batchIndex          int
-	flushLock           sync.Mutex
-	isDcpRebalancing    bool
-	metricsRecorder     mongodb.MetricsRecorder
-	shardKeys           []string
-	bulkRequestTimeout  time.Duration
+	client               *mongo.Client
+	database             *mongo.Database
+	collectionMapping    map[string]string
+	collectionOptions    map[string]config.CollectionOptions
+	transaction          config.Transaction
+	provisioning         config.Provisioning
+	provisionChanges     []ProvisionChange
+	schemas              map[string]*jsonschema.Schema
+	sink                 WriteSink
+	dcpCheckpointCommit  func()
+	batchCommitTicker    *time.Ticker
+	batchTickerDuration  time.Duration
+	batchSizeLimit       int
+	batchByteSizeLimit   int
+	concurrentRequest    int
+	adaptive             *adaptiveController
+	partitions           []*partition
+	isDcpRebalancing     bool
+	metricsRecorder      mongodb.ExtendedMetricsRecorder
+	shardKeys            []string
+	bulkRequestTimeout   time.Duration
+	pauseLock            sync.Mutex
+	pauseCond            *sync.Cond
+	isPaused             bool
+	offsets              *checkpointOffsets
+	commitLock           sync.Mutex
+	eventLock            sync.RWMutex
+	statsLock            sync.Mutex
+	bufferLock           sync.Mutex
+	bufferCond           *sync.Cond
+	bufferedDocuments    int
+	bufferedBytes        int
+	maxBufferedDocuments int
+	maxBufferedBytes     int
+	isBufferClosed       bool
+	lastFlushTime        time.Time
+	lastError            error
+	collectionStats      map[string]*CollectionStats
+	isAlive              atomic.Bool
+	errCh                chan error
+	done                 chan struct{}
+	writeCtx             context.Context
+	cancelWrites         context.CancelFunc
+	closeOnce            sync.Once
+	ownsClient           bool
+	isDryRunCommitted    bool
+	hooks                mongodb.Hooks
+}
+
+type Status struct {
+	LastFlushTime     time.Time                  `json:"lastFlushTime"`
+	Collections       map[string]CollectionStats `json:"collections"`
+	LastError         string                     `json:"lastError,omitempty"`
+	Provisioning      []ProvisionChange          `json:"provisioning,omitempty"`
+	BatchSize         int                        `json:"batchSize"`
+	BatchByteSize     int                        `json:"batchByteSize"`
+	InFlight          int                        `json:"inFlightBatches"`
+	Partitions        int                        `json:"partitions"`
+	SizeLimit         int                        `json:"sizeLimit"`
+	ConcurrentRequest int                        `json:"concurrentRequest"`
+	BufferedDocuments int                        `json:"bufferedDocuments"`
+	BufferedBytes     int                        `json:"bufferedBytes"`
+	Paused            bool                       `json:"paused"`
+	DryRun            bool                       `json:"dryRun"`
 }
 
+type CollectionStats struct {
+	UpdateSuccess int64 `json:"updateSuccess"`
+	UpdateMatched int64 `json:"updateMatched"`
+	UpdateError   int64 `json:"updateError"`
+	DeleteSuccess int64 `json:"deleteSuccess"`
+	DeleteError   int64 `json:"deleteError"`
+}
+
+// MaxDocumentByteSize is the BSON document size limit of MongoDB,
+// MaxMessageByteSize the limit of a single bulk write message sent to the server.
+const (
+	MaxDocumentByteSize = 16 * 1024 * 1024
+	MaxMessageByteSize  = 48000000
+	messageOverhead     = 16 * 1024
+)
+
 type BatchItem struct {
 	Model mongodb.Model
-	Bytes []byte
+	// Bytes is the BSON encoded document, it is sent as is for replacements and inserts.
+	Bytes bson.Raw
 	Size  int
+	// Event is the index of the event in its batch, the items of an event are written together in a transaction.
+	Event int
+	// Replace writes a merge combined with an earlier replacement or delete of the document as a replacement.
+	Replace bool
 }
 
-func NewBulk(cfg *config.Config, dcpCheckpointCommit func()) (*Bulk, error) {
-	client, err := client.NewMongoClient(cfg.MongoDB)
+// NewBulk uses mongoClient when given and leaves disconnecting it to the caller,
+// otherwise it creates its own client from the config and disconnects it on Shutdown.
+// In dry run, enabled by the config or by a sink, the write models are sent to the sink instead and no client is
+// created, a given mongoClient is only read from.
+func NewBulk(
+	cfg *config.Config, dcpCheckpointCommit func(), mongoClient *mongo.Client, hooks mongodb.Hooks, sink WriteSink,
+) (*Bulk, error) {
+	schemas, err := compileSchemas(cfg.MongoDB.CollectionOptions)
 	if err != nil {
 		return nil, err
 	}
 
+	provisioning := cfg.MongoDB.Provisioning
+	if sink == nil && cfg.MongoDB.DryRun.Enabled {
+		if sink, err = newWriteSink(cfg.MongoDB.DryRun); err != nil {
+			return nil, err
+		}
+	}
+	if sink != nil {
+		provisioning.DryRun = true
+	}
+
+	ownsClient := mongoClient == nil && sink == nil
+	if ownsClient {
+		mongoClient, err = client.NewMongoClient(cfg.MongoDB)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var database *mongo.Database
+	if mongoClient != nil {
+		database = mongoClient.Database(cfg.MongoDB.Connection.Database)
+	}
+
 	var shardKeys []string
 	if cfg.MongoDB.ShardKeys != nil {
 		shardKeys = cfg.MongoDB.ShardKeys
@@ -72,183 +169,411 @@ func NewBulk(cfg *config.Config, dcpCheckpointCommit func()) (*Bulk, error) {
 	bulkRequestTimeout := time.Duration(cfg.MongoDB.Timeouts.BulkRequestTimeoutMS) * time.Millisecond
 
 	b := &Bulk{
-		client:              client,
-		database:            client.Database(cfg.MongoDB.Connection.Database),
-		collectionMapping:   cfg.MongoDB.CollectionMapping,
-		dcpCheckpointCommit: dcpCheckpointCommit,
-		batchTickerDuration: batchTickerDuration,
-		batchTicker:         time.NewTicker(batchTickerDuration),
-		batchSizeLimit:      batchSizeLimit,
-		batchByteSizeLimit:  batchByteSizeLimit,
-		concurrentRequest:   concurrentRequest,
-		batch:               make([]BatchItem, 0, batchSizeLimit),
-		batchKeys:           make(map[string]int, batchSizeLimit),
-		shardKeys:           shardKeys,
-		metricsRecorder:     metric.NewMetricsRecorder(),
-		bulkRequestTimeout:  bulkRequestTimeout,
+		client:               mongoClient,
+		ownsClient:           ownsClient,
+		hooks:                hooks,
+		database:             database,
+		collectionMapping:    cfg.MongoDB.CollectionMapping,
+		collectionOptions:    cfg.MongoDB.CollectionOptions,
+		transaction:          cfg.MongoDB.Transaction,
+		provisioning:         provisioning,
+		sink:                 sink,
+		isDryRunCommitted:    cfg.MongoDB.DryRun.Commit,
+		schemas:              schemas,
+		dcpCheckpointCommit:  dcpCheckpointCommit,
+		batchTickerDuration:  batchTickerDuration,
+		batchSizeLimit:       batchSizeLimit,
+		batchByteSizeLimit:   batchByteSizeLimit,
+		concurrentRequest:    concurrentRequest,
+		shardKeys:            shardKeys,
+		metricsRecorder:      metric.NewMetricsRecorder(),
+		bulkRequestTimeout:   bulkRequestTimeout,
+		maxBufferedDocuments: cfg.MongoDB.Batch.MaxBufferedDocuments,
+		maxBufferedBytes:     helpers.ResolveUnionIntOrStringValue(cfg.MongoDB.Batch.MaxBufferedBytes),
+		collectionStats:      make(map[string]*CollectionStats),
+		offsets:              newCheckpointOffsets(),
+		errCh:                make(chan error, 1),
+		done:                 make(chan struct{}),
+	}
+	b.pauseCond = sync.NewCond(&b.pauseLock)
+	b.bufferCond = sync.NewCond(&b.bufferLock)
+	b.writeCtx, b.cancelWrites = context.WithCancel(context.Background())
+
+	if err := b.prepareDatabase(context.Background()); err != nil {
+		if ownsClient {
+			_ = mongoClient.Disconnect(context.Background())
+		}
+		return nil, err
+	}
+
+	if cfg.MongoDB.Batch.Adaptive.Enabled {
+		b.adaptive = newAdaptiveController(cfg.MongoDB.Batch.Adaptive, batchSizeLimit, concurrentRequest, b.metricsRecorder)
 	}
 
 	if batchCommitTickerDuration := cfg.MongoDB.Batch.CommitTickerDuration; batchCommitTickerDuration != nil {
 		b.batchCommitTicker = time.NewTicker(*batchCommitTickerDuration)
 	}
 
+	b.partitions = make([]*partition, cfg.MongoDB.Batch.Partitions)
+	for i := range b.partitions {
+		b.partitions[i] = newPartition(b, i, cfg.MongoDB.Batch.MaxInFlightBatches)
+		go b.partitions[i].runWriter()
+	}
+
 	return b, nil
 }
 
+// prepareDatabase checks that the deployment supports the configured writes and provisions the collections. A dry run
+// without a client has no database to prepare.
+func (b *Bulk) prepareDatabase(ctx context.Context) error {
+	if b.database == nil {
+		logger.Log.Info("provisioning skipped, dry run has no mongodb client")
+		return nil
+	}
+
+	if b.transaction.Scope != "" {
+		if err := checkTransactionSupport(ctx, b.database); err != nil {
+			return err
+		}
+	}
+
+	if err := b.provision(ctx); err != nil {
+		return err
+	}
+
+	return b.checkTimeSeriesCollections(ctx)
+}
+
 func (b *Bulk) StartBulk() {
-	for range b.batchTicker.C {
-		b.flushMessages()
+	b.isAlive.Store(true)
+	defer b.isAlive.Store(false)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.runCommitTicker(b.done)
+	}()
+	for _, p := range b.partitions {
+		wg.Add(1)
+		go func(p *partition) {
+			defer wg.Done()
+			p.runTicker(b.done)
+		}(p)
+	}
+	wg.Wait()
+}
+
+// Errors delivers errors the bulk cannot recover from, the connector stops when it receives one.
+func (b *Bulk) Errors() <-chan error {
+	return b.errCh
+}
+
+func (b *Bulk) reportError(err error) {
+	logger.Log.Error("%v", err)
+	b.setLastError(err)
+
+	select {
+	case b.errCh <- err:
+	default:
 	}
 }
 
 func (b *Bulk) Close() {
-	b.batchTicker.Stop()
+	if err := b.Shutdown(context.Background()); err != nil {
+		logger.Log.Error("error while closing bulk: %v", err)
+	}
+}
+
+// Shutdown stops the ticker loop, flushes and commits what is left in the batch within the given context
+// and disconnects the MongoDB client unless it was supplied by the caller. When the context is done first,
+// the writes still running are cancelled and nothing more is committed.
+func (b *Bulk) Shutdown(ctx context.Context) error {
+	var err error
+	b.closeOnce.Do(func() {
+		err = b.shutdown(ctx)
+	})
+	return err
+}
+
+func (b *Bulk) shutdown(ctx context.Context) error {
+	stopCancel := context.AfterFunc(ctx, b.cancelWrites)
+	defer stopCancel()
+	defer b.cancelWrites()
+
+	close(b.done)
+	b.closeBuffer()
 	if b.batchCommitTicker != nil {
 		b.batchCommitTicker.Stop()
 	}
-	b.flushMessages()
+	b.Resume()
+
+	flushErr := b.flushAndCommit(ctx)
+	if flushErr != nil {
+		flushErr = fmt.Errorf("final flush failed, uncommitted messages will be reprocessed: %w", flushErr)
+	}
+
+	for _, p := range b.partitions {
+		p.close()
+	}
+
+	for _, p := range b.partitions {
+		select {
+		case <-p.writerDone:
+		case <-ctx.Done():
+		}
+	}
+
+	if closer, ok := b.sink.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			flushErr = errors.Join(flushErr, fmt.Errorf("error while closing dry run sink: %w", err))
+		}
+	}
+
+	if !b.ownsClient {
+		return flushErr
+	}
+
+	if err := b.client.Disconnect(ctx); err != nil {
+		return errors.Join(flushErr, fmt.Errorf("error while disconnecting mongodb client: %w", err))
+	}
+
+	return flushErr
 }
 
+// AddActions routes the event to the partition of its vbucket and acks it. go-dcp also moves the offsets on events
+// that never reach the listener, so an acked event may be covered by a later offset before its batch is written.
+// The checkpoint therefore only saves the offsets taken when the batches were handed over, see flushAndCommit.
 func (b *Bulk) AddActions(
 	ctx *models.ListenerContext,
 	eventTime time.Time,
 	actions []mongodb.Model,
 	couchbaseCollectionName string,
+	vbID uint16,
 ) {
-	b.flushLock.Lock()
+	b.waitWhilePaused()
+	b.waitForBuffer()
+
+	b.eventLock.RLock()
+	p := b.partitions[int(vbID)%len(b.partitions)]
+	p.flushLock.Lock()
+
+	if p.isClosed {
+		logger.Log.Warn("could not add new message to batch after bulk is closed")
+		p.flushLock.Unlock()
+		b.eventLock.RUnlock()
+		return
+	}
 
 	if b.isDcpRebalancing {
 		logger.Log.Warn("could not add new message to batch while rebalancing")
-		b.flushLock.Unlock()
+		p.flushLock.Unlock()
+		b.eventLock.RUnlock()
 		return
 	}
 
-	mongoDBCollectionName := b.getCollectionName(couchbaseCollectionName)
+	var mongoDBCollectionName string
+	if len(actions) > 0 {
+		var err error
+		mongoDBCollectionName, err = b.getCollectionName(couchbaseCollectionName)
+		if err != nil {
+			p.flushLock.Unlock()
+			b.eventLock.RUnlock()
+			b.reportError(err)
+			return
+		}
+	}
+
+	batchSize, batchByteSize := p.batchSize, p.batchByteSize
 
 	for _, action := range actions {
-		if rawModel, ok := action.(*mongodb.Raw); ok {
-			rawModel.MongoCollection = mongoDBCollectionName
-		}
+		setCollection(action, mongoDBCollectionName)
+	}
+
+	actions, err := b.validateDocuments(actions)
+	if err != nil {
+		p.flushLock.Unlock()
+		b.eventLock.RUnlock()
+		b.reportError(err)
+		return
+	}
 
-		bytes, err := sonic.Marshal(action)
+	actions = b.withVersions(ctx, eventTime, b.withHistory(ctx, eventTime, actions))
+
+	for _, action := range b.withTimeSeries(eventTime, actions) {
+		bytes, err := marshalDocument(action)
 		if err != nil {
 			logger.Log.Error("error marshaling action: %v", err)
 			continue
 		}
 		size := len(bytes)
 
-		key := b.getActionKey(action)
-
-		if batchIndex, ok := b.batchKeys[key]; ok {
-			b.batchByteSize += size - b.batch[batchIndex].Size
-			b.batch[batchIndex] = BatchItem{
-				Model: action,
-				Bytes: bytes,
-				Size:  size,
-			}
-		} else {
-			b.batch = append(b.batch, BatchItem{
-				Model: action,
-				Bytes: bytes,
-				Size:  size,
-			})
-			b.batchKeys[key] = b.batchIndex
-			b.batchIndex++
-			b.batchSize++
-			b.batchByteSize += size
+		if size > MaxDocumentByteSize {
+			b.rejectDocument(mongoDBCollectionName, action,
+				fmt.Errorf("document size %d bytes exceeds mongodb limit of %d bytes", size, MaxDocumentByteSize))
+			continue
 		}
+
+		p.add(BatchItem{
+			Model: action,
+			Bytes: bytes,
+			Size:  size,
+			Event: p.batchEvents,
+		})
 	}
+	p.batchEvents++
 
 	ctx.Ack()
-	b.flushLock.Unlock()
+	isBatchFull := p.isFull()
+	b.addBuffered(p.batchSize-batchSize, p.batchByteSize-batchByteSize)
+	p.flushLock.Unlock()
+	b.eventLock.RUnlock()
 
 	b.metricsRecorder.RecordProcessLatency(time.Since(eventTime).Milliseconds())
 
-	if b.batchSize >= b.batchSizeLimit || b.batchByteSize >= b.batchByteSizeLimit {
-		b.flushMessages()
+	if isBatchFull {
+		if _, err := p.handoff(b.writeCtx); err != nil {
+			b.reportError(err)
+		}
 	}
 }
 
-func (b *Bulk) getCollectionName(couchbaseCollectionName string) string {
-	if mongoCollectionName, exists := b.collectionMapping[couchbaseCollectionName]; exists {
-		return mongoCollectionName
+func marshalDocument(model mongodb.Model) (bson.Raw, error) {
+	switch m := model.(type) {
+	case *mongodb.Raw:
+		return bson.Marshal(m.Document)
+	case *mongodb.DeleteMany:
+		return bson.Marshal(bson.M{"q": m.Filter})
+	case *mongodb.UpdateMany:
+		return bson.Marshal(bson.M{"q": m.Filter, "u": m.Update})
+	case *mongodb.PipelineUpdate:
+		return bson.Marshal(bson.M{"q": m.GetFilter(), "u": m.Pipeline})
+	case *historyRecord:
+		return bson.Marshal(m.toDocument())
+	case *versionModel:
+		return bson.Marshal(m.change.document)
+	case *measurement:
+		return bson.Marshal(m.document)
+	default:
+		return bson.Marshal(model.Convert().Document)
 	}
-
-	logger.Log.Error("there is no collection mapping for couchbase collection: %s", couchbaseCollectionName)
-	panic(fmt.Errorf("there is no collection mapping for couchbase collection: %s", couchbaseCollectionName))
 }
 
-func (b *Bulk) getActionKey(model mongodb.Model) string {
-	if rawModel, ok := model.(*mongodb.Raw); ok {
-		mongoCollection := rawModel.MongoCollection
+func (b *Bulk) rejectDocument(collection string, model mongodb.Model, err error) {
+	logger.Log.Error("skipping document of collection %s: %v", collection, err)
 
-		if rawModel.ID != "" {
-			return fmt.Sprintf("%s:%s", mongoCollection, rawModel.ID)
-		}
+	b.metricsRecorder.RecordUpdateError(collection, 1)
+	b.hooks.DocumentFailed(mongodb.DocumentFailedContext{
+		Model:      model,
+		Err:        err,
+		Collection: collection,
+	})
+}
 
-		if id, ok := rawModel.Document["_id"]; ok {
-			return fmt.Sprintf("%s:%v", mongoCollection, id)
+// splitByMessageSize splits items into consecutive groups whose documents fit into a single bulk write message.
+// The close of an SCD version change stays in the group of the version it opens.
+func splitByMessageSize(items []BatchItem, messageByteSize int) [][]BatchItem {
+	var groups [][]BatchItem
+
+	start, size := 0, 0
+	for i, item := range items {
+		if i > start && size+item.Size > messageByteSize {
+			end := i
+			if open, ok := items[i-1].Model.(*versionModel); ok && i-1 > start && open.closes(item.Model) {
+				end--
+			}
+			groups = append(groups, items[start:end])
+			start, size = end, 0
+			for _, moved := range items[end:i] {
+				size += moved.Size
+			}
 		}
+		size += item.Size
+	}
+
+	if start < len(items) {
+		groups = append(groups, items[start:])
 	}
 
-	return fmt.Sprintf("batch:%d", b.batchIndex)
+	return groups
 }
 
-func (b *Bulk) flushMessages() {
-	b.flushLock.Lock()
-	defer b.flushLock.Unlock()
+// sizeLimit is the batch size limit in effect, tuned by the adaptive controller when it is enabled.
+func (b *Bulk) sizeLimit() int {
+	if b.adaptive != nil {
+		return b.adaptive.SizeLimit()
+	}
+	return b.batchSizeLimit
+}
 
-	if b.isDcpRebalancing {
-		return
+// concurrency is the concurrent request count in effect, tuned by the adaptive controller when it is enabled.
+func (b *Bulk) concurrency() int {
+	if b.adaptive != nil {
+		return b.adaptive.Concurrency()
 	}
+	return b.concurrentRequest
+}
 
-	if len(b.batch) > 0 {
-		err := b.bulkRequest()
-		if err != nil {
-			logger.Log.Error("error while bulk request: %v", err)
-			panic(err)
-		}
+func (b *Bulk) getCollectionName(couchbaseCollectionName string) (string, error) {
+	if mongoCollectionName, exists := b.collectionMapping[couchbaseCollectionName]; exists {
+		return mongoCollectionName, nil
+	}
+
+	return "", fmt.Errorf("there is no collection mapping for couchbase collection: %s", couchbaseCollectionName)
+}
+
+func (b *Bulk) bulkRequest(ctx context.Context, batch []BatchItem) error {
+	startedTime := time.Now()
+
+	var err error
+	switch {
+	case b.sink != nil:
+		err = b.dryRunRequest(ctx, batch)
+	case b.transaction.Scope != "":
+		err = b.transactionalRequest(ctx, batch)
+	default:
+		err = b.chunkedRequest(ctx, batch)
+	}
 
-		b.batchTicker.Reset(b.batchTickerDuration)
+	latency := time.Since(startedTime)
+	b.metricsRecorder.RecordBulkRequestProcessLatency(latency.Milliseconds())
 
-		b.batch = b.batch[:0]
-		b.batchKeys = make(map[string]int, b.batchSizeLimit)
-		b.batchIndex = 0
-		b.batchSize = 0
-		b.batchByteSize = 0
+	if b.adaptive != nil {
+		b.adaptive.observe(latency, len(batch), err)
 	}
 
-	b.checkAndCommit()
+	return err
 }
 
-func (b *Bulk) bulkRequest() error {
-	eg, egCtx := errgroup.WithContext(context.Background())
+func (b *Bulk) chunkedRequest(ctx context.Context, batch []BatchItem) error {
+	if slices.ContainsFunc(batch, func(item BatchItem) bool { return isFilterModel(item.Model) }) {
+		return b.sequentialRequest(ctx, batch)
+	}
 
-	startedTime := time.Now()
+	eg, egCtx := errgroup.WithContext(ctx)
+	b.processChunks(egCtx, b.requestChunks(batch), eg)
+	return eg.Wait()
+}
 
-	if len(b.collectionMapping) == 1 {
-		chunks := helpers.ChunkSlice(b.batch, b.concurrentRequest)
-		b.processChunks(egCtx, chunks, eg)
-	} else {
-		collectionGroups := make(map[string][]BatchItem)
-		for _, item := range b.batch {
-			if rawModel, ok := item.Model.(*mongodb.Raw); ok {
-				collection := rawModel.MongoCollection
-				collectionGroups[collection] = append(collectionGroups[collection], item)
-			}
-		}
+// requestChunks splits the batch into the chunks written concurrently. The batch is grouped by collection first, since
+// even with a single collection mapping it holds the writes of derived collections such as history collections.
+func (b *Bulk) requestChunks(batch []BatchItem) [][]BatchItem {
+	var chunks [][]BatchItem
+	for _, items := range groupByCollection(batch) {
+		chunks = append(chunks, b.chunkItems(items)...)
+	}
+	return chunks
+}
 
-		for _, items := range collectionGroups {
-			chunks := helpers.ChunkSlice(items, b.concurrentRequest)
-			b.processChunks(egCtx, chunks, eg)
+// chunkItems splits items of a collection for concurrent requests, items of an ordered collection are kept in a single chunk.
+func (b *Bulk) chunkItems(items []BatchItem) [][]BatchItem {
+	if len(items) > 0 {
+		if collection, ok := collectionOf(items[0].Model); ok && b.isOrdered(collection) {
+			return [][]BatchItem{items}
 		}
 	}
 
-	err := eg.Wait()
-
-	b.metricsRecorder.RecordBulkRequestProcessLatency(time.Since(startedTime).Milliseconds())
-
-	return err
+	return helpers.ChunkSlice(items, b.concurrency())
 }
 
 func (b *Bulk) processChunks(ctx context.Context, chunks [][]BatchItem, eg *errgroup.Group) {
@@ -265,59 +590,162 @@ func (b *Bulk) processBatchChunk(ctx context.Context, batchItems []BatchItem) fu
 			return fmt.Errorf("context cancelled before processing: %w", err)
 		}
 
-		operations := make(map[string][]mongo.WriteModel)
-
+		collectionItems := make(map[string][]BatchItem)
 		for _, item := range batchItems {
-			model := item.Model
-			if rawModel, ok := model.(*mongodb.Raw); ok {
-				collection := rawModel.MongoCollection
-
-				var writeModel mongo.WriteModel
-				switch rawModel.Operation {
-				case mongodb.Insert, mongodb.Update, mongodb.Upsert:
-					writeModel = mongo.NewReplaceOneModel().
-						SetFilter(b.buildFilter(rawModel.Document)).
-						SetReplacement(rawModel.Document).
-						SetUpsert(true)
-				case mongodb.Delete:
-					writeModel = mongo.NewDeleteOneModel().SetFilter(b.buildFilter(rawModel.Document))
-				default:
-					writeModel = mongo.NewInsertOneModel().SetDocument(rawModel.Document)
-				}
-
-				operations[collection] = append(operations[collection], writeModel)
+			if collection, ok := collectionOf(item.Model); ok {
+				collectionItems[collection] = append(collectionItems[collection], item)
 			}
 		}
 
 		bulkWriteCtx, cancel := context.WithTimeout(ctx, b.bulkRequestTimeout)
 		defer cancel()
 
-		for collectionName, writeModels := range operations {
-			collection := b.database.Collection(collectionName)
-
-			opts := options.BulkWrite().SetOrdered(false)
-			result, err := collection.BulkWrite(bulkWriteCtx, writeModels, opts)
-
-			if err != nil {
-				if mongoErr, ok := err.(mongo.BulkWriteException); ok {
-					for _, writeErr := range mongoErr.WriteErrors {
-						if writeErr.Code == 11000 {
-							logger.Log.Error("Duplicate key error: %v\n", err)
-						}
-					}
-					continue
+		for collectionName, items := range collectionItems {
+			for _, messageItems := range splitByMessageSize(items, MaxMessageByteSize-messageOverhead) {
+				if err := b.bulkWrite(bulkWriteCtx, collectionName, messageItems); err != nil {
+					return err
 				}
-				b.recordErrors(collectionName, writeModels)
-				return fmt.Errorf("bulk write error for collection %s: %v", collectionName, err)
 			}
-
-			b.recordSuccess(collectionName, result)
 		}
 
 		return nil
 	}
 }
 
+func (b *Bulk) bulkWrite(ctx context.Context, collectionName string, items []BatchItem) error {
+	if b.isOrdered(collectionName) {
+		return b.orderedBulkWrite(ctx, collectionName, items)
+	}
+
+	writeErrors, err := b.executeBulkWrite(ctx, collectionName, items, false)
+	if err != nil {
+		return err
+	}
+
+	return b.handleWriteErrors(ctx, collectionName, items, writeErrors)
+}
+
+// executeBulkWrite returns the errors of the documents MongoDB rejected, err is only set when the request itself failed.
+func (b *Bulk) executeBulkWrite(
+	ctx context.Context, collectionName string, items []BatchItem, ordered bool,
+) ([]mongo.BulkWriteError, error) {
+	writeModels := make([]mongo.WriteModel, 0, len(items))
+	for _, item := range items {
+		writeModels = append(writeModels, b.buildWriteModel(item))
+	}
+
+	return b.executeWriteModels(ctx, collectionName, writeModels, ordered)
+}
+
+func (b *Bulk) executeWriteModels(
+	ctx context.Context, collectionName string, writeModels []mongo.WriteModel, ordered bool,
+) ([]mongo.BulkWriteError, error) {
+	collection := b.database.Collection(collectionName)
+
+	opts := options.BulkWrite().SetOrdered(ordered)
+	result, err := collection.BulkWrite(ctx, writeModels, opts)
+
+	if err != nil {
+		if mongoErr, ok := err.(mongo.BulkWriteException); ok {
+			if result != nil {
+				b.recordSuccess(collectionName, result)
+			}
+			return mongoErr.WriteErrors, nil
+		}
+		b.recordErrors(collectionName, writeModels)
+		b.hooks.BulkError(mongodb.BulkErrorContext{
+			Err:        err,
+			Collection: collectionName,
+			Count:      len(writeModels),
+		})
+		return nil, fmt.Errorf("bulk write error for collection %s: %v", collectionName, err)
+	}
+
+	b.recordSuccess(collectionName, result)
+
+	return nil, nil
+}
+
+func (b *Bulk) documentFailed(collectionName string, item BatchItem, err error) {
+	b.recordErrors(collectionName, []mongo.WriteModel{b.buildWriteModel(item)})
+
+	if b.adaptive != nil {
+		b.adaptive.recordFailures(1)
+	}
+
+	var code int
+	var writeErr mongo.BulkWriteError
+	if errors.As(err, &writeErr) {
+		code = writeErr.Code
+	}
+
+	b.hooks.DocumentFailed(mongodb.DocumentFailedContext{
+		Model:      item.Model,
+		Err:        err,
+		Collection: collectionName,
+		Code:       code,
+	})
+}
+
+func (b *Bulk) buildWriteModel(item BatchItem) mongo.WriteModel {
+	switch model := item.Model.(type) {
+	case *mongodb.DeleteMany:
+		return mongo.NewDeleteManyModel().SetFilter(model.Filter)
+	case *mongodb.UpdateMany:
+		return mongo.NewUpdateManyModel().
+			SetFilter(model.Filter).
+			SetUpdate(model.Update).
+			SetUpsert(model.Upsert)
+	case *mongodb.PipelineUpdate:
+		return buildPipelineUpdateModel(model)
+	case *historyRecord:
+		return mongo.NewInsertOneModel().SetDocument(model.toDocument())
+	case *versionModel:
+		return model.toWriteModel()
+	case *measurement:
+		return mongo.NewInsertOneModel().SetDocument(model.document)
+	}
+
+	rawModel := item.Model.(*mongodb.Raw)
+
+	if !item.Replace && b.isMerge(rawModel) {
+		return b.buildMergeModel(rawModel)
+	}
+
+	switch rawModel.Operation {
+	case mongodb.Update, mongodb.Upsert:
+		return b.buildReplaceModel(rawModel, item.Bytes)
+	case mongodb.Delete:
+		return mongo.NewDeleteOneModel().SetFilter(b.buildFilter(rawModel.Document))
+	default:
+		return mongo.NewInsertOneModel().SetDocument(item.Bytes)
+	}
+}
+
+func (b *Bulk) buildReplaceModel(rawModel *mongodb.Raw, document bson.Raw) *mongo.ReplaceOneModel {
+	return mongo.NewReplaceOneModel().
+		SetFilter(b.buildFilter(rawModel.Document)).
+		SetReplacement(document).
+		SetUpsert(true)
+}
+
+func buildPipelineUpdateModel(model *mongodb.PipelineUpdate) *mongo.UpdateOneModel {
+	updateModel := mongo.NewUpdateOneModel().
+		SetFilter(model.GetFilter()).
+		SetUpdate(model.Pipeline).
+		SetUpsert(model.Upsert)
+
+	if model.Collation != nil {
+		updateModel.SetCollation(model.Collation)
+	}
+
+	if model.Hint != nil {
+		updateModel.SetHint(model.Hint)
+	}
+
+	return updateModel
+}
+
 func (b *Bulk) buildFilter(document map[string]interface{}) bson.M {
 	filter := bson.M{"_id": document["_id"]}
 
@@ -355,31 +783,175 @@ func (b *Bulk) getNestedValue(document map[string]interface{}, path string) inte
 }
 
 func (b *Bulk) recordErrors(collection string, operations []mongo.WriteModel) {
+	b.statsLock.Lock()
+	defer b.statsLock.Unlock()
+
+	stats := b.getCollectionStats(collection)
+
 	for _, op := range operations {
 		switch op.(type) {
-		case *mongo.UpdateOneModel, *mongo.UpdateManyModel:
+		case *mongo.InsertOneModel, *mongo.ReplaceOneModel, *mongo.UpdateOneModel, *mongo.UpdateManyModel:
 			b.metricsRecorder.RecordUpdateError(collection, 1)
+			stats.UpdateError++
 		case *mongo.DeleteOneModel, *mongo.DeleteManyModel:
 			b.metricsRecorder.RecordDeleteError(collection, 1)
+			stats.DeleteError++
 		}
 	}
 }
 
+// recordSuccess counts the modified and upserted documents as updates, matched documents are counted on their own since
+// a many model may match documents it leaves unchanged.
 func (b *Bulk) recordSuccess(collection string, result *mongo.BulkWriteResult) {
-	b.metricsRecorder.RecordUpdateSuccess(collection, result.ModifiedCount+result.UpsertedCount)
+	updated := result.ModifiedCount + result.UpsertedCount
+
+	b.metricsRecorder.RecordUpdateSuccess(collection, updated)
+	b.metricsRecorder.RecordUpdateMatched(collection, result.MatchedCount)
 	b.metricsRecorder.RecordDeleteSuccess(collection, result.DeletedCount)
+
+	b.statsLock.Lock()
+	defer b.statsLock.Unlock()
+
+	stats := b.getCollectionStats(collection)
+	stats.UpdateSuccess += updated
+	stats.UpdateMatched += result.MatchedCount
+	stats.DeleteSuccess += result.DeletedCount
 }
 
-func (b *Bulk) checkAndCommit() {
-	if b.batchCommitTicker == nil {
-		b.dcpCheckpointCommit()
-		return
+func (b *Bulk) getCollectionStats(collection string) *CollectionStats {
+	stats, ok := b.collectionStats[collection]
+	if !ok {
+		stats = &CollectionStats{}
+		b.collectionStats[collection] = stats
 	}
+	return stats
+}
 
-	select {
-	case <-b.batchCommitTicker.C:
-		b.dcpCheckpointCommit()
-	default:
+func (b *Bulk) setLastError(err error) {
+	b.statsLock.Lock()
+	b.lastError = err
+	b.statsLock.Unlock()
+}
+
+func (b *Bulk) setLastFlushTime(t time.Time) {
+	b.statsLock.Lock()
+	b.lastFlushTime = t
+	b.statsLock.Unlock()
+}
+
+// Pause blocks AddActions, and therefore the dcp listener, until Resume is called.
+func (b *Bulk) Pause() {
+	b.pauseLock.Lock()
+	b.isPaused = true
+	b.pauseLock.Unlock()
+	logger.Log.Info("bulk ingestion paused")
+}
+
+func (b *Bulk) Resume() {
+	b.pauseLock.Lock()
+	wasPaused := b.isPaused
+	b.isPaused = false
+	b.pauseLock.Unlock()
+
+	if wasPaused {
+		b.pauseCond.Broadcast()
+		logger.Log.Info("bulk ingestion resumed")
+	}
+}
+
+func (b *Bulk) waitWhilePaused() {
+	b.pauseLock.Lock()
+	for b.isPaused {
+		b.pauseCond.Wait()
+	}
+	b.pauseLock.Unlock()
+}
+
+// ForceFlush writes the current batch and commits the checkpoint regardless of the commit ticker.
+func (b *Bulk) ForceFlush(ctx context.Context) error {
+	err := b.flushAndCommit(ctx)
+	if err != nil {
+		b.setLastError(err)
+	}
+	return err
+}
+
+func (b *Bulk) IsAlive() bool {
+	return b.isAlive.Load()
+}
+
+func (b *Bulk) LastFlushTime() time.Time {
+	b.statsLock.Lock()
+	defer b.statsLock.Unlock()
+	return b.lastFlushTime
+}
+
+// Ping succeeds without a client, a dry run without one does not depend on MongoDB.
+func (b *Bulk) Ping(ctx context.Context) error {
+	if b.client == nil {
+		return nil
+	}
+	return b.client.Ping(ctx, nil)
+}
+
+func (b *Bulk) Status() Status {
+	b.pauseLock.Lock()
+	isPaused := b.isPaused
+	b.pauseLock.Unlock()
+
+	var batchSize, batchByteSize, inFlight int
+	for _, p := range b.partitions {
+		p.flushLock.Lock()
+		batchSize += p.batchSize
+		batchByteSize += p.batchByteSize
+		p.flushLock.Unlock()
+		inFlight += int(p.inFlightBatches.Load())
+	}
+
+	b.bufferLock.Lock()
+	bufferedDocuments, bufferedBytes := b.bufferedDocuments, b.bufferedBytes
+	b.bufferLock.Unlock()
+
+	b.statsLock.Lock()
+	defer b.statsLock.Unlock()
+
+	status := Status{
+		LastFlushTime:     b.lastFlushTime,
+		Collections:       make(map[string]CollectionStats, len(b.collectionStats)),
+		BatchSize:         batchSize,
+		BatchByteSize:     batchByteSize,
+		InFlight:          inFlight,
+		Partitions:        len(b.partitions),
+		SizeLimit:         b.sizeLimit(),
+		ConcurrentRequest: b.concurrency(),
+		BufferedDocuments: bufferedDocuments,
+		BufferedBytes:     bufferedBytes,
+		Provisioning:      b.provisionChanges,
+		Paused:            isPaused,
+		DryRun:            b.sink != nil,
+	}
+
+	if b.lastError != nil {
+		status.LastError = b.lastError.Error()
+	}
+
+	for collection, stats := range b.collectionStats {
+		status.Collections[collection] = *stats
+	}
+
+	return status
+}
+
+// commit saves the given offsets through the metadata wrapped by CheckpointMetadata.
+func (b *Bulk) commit(offsets map[uint16]*models.Offset) {
+	if b.sink != nil && !b.isDryRunCommitted {
 		return
 	}
+
+	b.commitLock.Lock()
+	defer b.commitLock.Unlock()
+
+	b.offsets.commit(offsets)
+	b.dcpCheckpointCommit()
+	b.hooks.Commit(mongodb.CommitContext{Time: time.Now()})
 }
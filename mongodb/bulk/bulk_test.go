@@ -1,14 +1,29 @@
 package bulk
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	config "github.com/Trendyol/go-dcp-mongodb/configs"
 	"github.com/Trendyol/go-dcp-mongodb/metric"
 	"github.com/Trendyol/go-dcp-mongodb/mongodb"
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/metadata"
+	"github.com/Trendyol/go-dcp/models"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func Test_it_should_handle_bulk_operations(t *testing.T) {
@@ -19,6 +34,12 @@ func Test_it_should_handle_bulk_operations(t *testing.T) {
 }
 
 func createTestBulkWithoutConnection(t *testing.T) *Bulk {
+	return createTestBulkWithPartitions(t, 1)
+}
+
+func createTestBulkWithPartitions(t *testing.T, partitions int) *Bulk {
+	logger.InitDefaultLogger(logger.ERROR)
+
 	cfg := &config.Config{
 		MongoDB: config.MongoDB{
 			Connection: config.Connection{
@@ -49,15 +70,25 @@ func createTestBulkWithoutConnection(t *testing.T) *Bulk {
 		collectionMapping:   cfg.MongoDB.CollectionMapping,
 		dcpCheckpointCommit: func() { t.Log("Checkpoint committed") },
 		batchTickerDuration: batchTickerDuration,
-		batchTicker:         time.NewTicker(batchTickerDuration),
 		batchSizeLimit:      batchSizeLimit,
 		batchByteSizeLimit:  1024 * 1024,
 		concurrentRequest:   concurrentRequest,
-		batch:               make([]BatchItem, 0, batchSizeLimit),
-		batchKeys:           make(map[string]int, batchSizeLimit),
 		shardKeys:           cfg.MongoDB.ShardKeys,
 		bulkRequestTimeout:  bulkRequestTimeout,
 		metricsRecorder:     metric.NewMetricsRecorder(),
+		collectionStats:     make(map[string]*CollectionStats),
+		offsets:             newCheckpointOffsets(),
+		errCh:               make(chan error, 1),
+		done:                make(chan struct{}),
+	}
+	bulk.pauseCond = sync.NewCond(&bulk.pauseLock)
+	bulk.bufferCond = sync.NewCond(&bulk.bufferLock)
+	bulk.writeCtx, bulk.cancelWrites = context.WithCancel(context.Background())
+
+	bulk.partitions = make([]*partition, partitions)
+	for i := range bulk.partitions {
+		bulk.partitions[i] = newPartition(bulk, i, cfg.MongoDB.Batch.MaxInFlightBatches)
+		go bulk.partitions[i].runWriter()
 	}
 
 	return bulk
@@ -106,7 +137,7 @@ func testItShouldHandleDeleteOperation(t *testing.T) {
 func testItShouldHandleBatchDeduplication(t *testing.T) {
 	bulk := createTestBulkWithoutConnection(t)
 
-	key := bulk.getActionKey(&mongodb.Raw{
+	key := bulk.partitions[0].getActionKey(&mongodb.Raw{
 		ID:              "doc1",
 		MongoCollection: "test",
 	})
@@ -267,9 +298,11 @@ func Test_getNestedValue_should_return_correct_nested_value(t *testing.T) {
 }
 
 func Test_getActionKey_should_return_correct_key(t *testing.T) {
-	bulk := &Bulk{
-		collectionMapping: map[string]string{"_default": "test_collection", "testCollection": "mongoDBTestCollection"},
-		batchIndex:        5,
+	bulk := &partition{
+		bulk: &Bulk{
+			collectionMapping: map[string]string{"_default": "test_collection", "testCollection": "mongoDBTestCollection"},
+		},
+		batchIndex: 5,
 	}
 
 	model := &mongodb.Raw{
@@ -314,3 +347,1469 @@ func Test_getActionKey_should_return_correct_key(t *testing.T) {
 		t.Errorf("Expected key %s, got %s", expectedKey, key)
 	}
 }
+
+func Test_getCollectionName_should_return_error_when_mapping_is_missing(t *testing.T) {
+	bulk := &Bulk{
+		collectionMapping: map[string]string{"_default": "test_collection"},
+	}
+
+	name, err := bulk.getCollectionName("_default")
+	if err != nil || name != "test_collection" {
+		t.Errorf("Expected 'test_collection', got %v, err: %v", name, err)
+	}
+
+	_, err = bulk.getCollectionName("unknown")
+	if err == nil {
+		t.Errorf("Expected error for unmapped collection")
+	}
+}
+
+func Test_StartBulk_should_return_when_done_is_closed(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+
+	stopped := make(chan struct{})
+	go func() {
+		bulk.StartBulk()
+		close(stopped)
+	}()
+
+	close(bulk.done)
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Expected StartBulk to return after done is closed")
+	}
+
+	if bulk.IsAlive() {
+		t.Errorf("Expected bulk not to be alive after StartBulk returned")
+	}
+}
+
+func Test_reportError_should_not_block_when_error_is_pending(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+
+	bulk.reportError(errors.New("first"))
+	bulk.reportError(errors.New("second"))
+
+	if err := <-bulk.Errors(); err.Error() != "first" {
+		t.Errorf("Expected first error, got %v", err)
+	}
+
+	if status := bulk.Status(); status.LastError != "second" {
+		t.Errorf("Expected last error to be 'second', got %v", status.LastError)
+	}
+}
+
+func Test_Shutdown_should_not_disconnect_supplied_client(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:27017"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bulk := createTestBulkWithoutConnection(t)
+	bulk.client = mongoClient
+
+	committed := false
+	bulk.dcpCheckpointCommit = func() { committed = true }
+
+	if err := bulk.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !committed {
+		t.Errorf("Expected checkpoint to be committed on shutdown")
+	}
+
+	if err := mongoClient.Disconnect(context.Background()); err != nil {
+		t.Errorf("Expected supplied client to be still connected, got %v", err)
+	}
+}
+
+func Test_Shutdown_should_return_by_the_deadline_while_a_write_is_blocked(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	sink := newStallingSink()
+	bulk.sink = sink
+	bulk.isDryRunCommitted = true
+
+	var commits atomic.Int32
+	bulk.dcpCheckpointCommit = func() { commits.Add(1) }
+
+	addTrackedEvent(bulk, "doc1", &models.Offset{SeqNo: 1})
+	if _, err := bulk.partitions[0].handoff(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	<-sink.started
+
+	// the only writer slot is taken by the blocked write, so the final flush has to wait for it
+	addTrackedEvent(bulk, "doc2", &models.Offset{SeqNo: 2})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- bulk.Shutdown(ctx) }()
+
+	select {
+	case err := <-shutdown:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the deadline error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected Shutdown to return by its deadline")
+	}
+
+	select {
+	case <-bulk.partitions[0].writerDone:
+	case <-time.After(time.Second):
+		t.Error("Expected the blocked write to be cancelled")
+	}
+
+	if commits.Load() != 0 {
+		t.Errorf("Expected nothing committed after the deadline, got %d commits", commits.Load())
+	}
+}
+
+func Test_ForceFlush_should_invoke_commit_hook(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+
+	var commitContext *mongodb.CommitContext
+	bulk.hooks = mongodb.Hooks{
+		OnCommit: func(ctx mongodb.CommitContext) {
+			commitContext = &ctx
+		},
+	}
+
+	if err := bulk.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if commitContext == nil || commitContext.Time.IsZero() {
+		t.Errorf("Expected commit hook to be invoked with commit time")
+	}
+}
+
+func Test_splitByMessageSize_should_keep_groups_within_limit(t *testing.T) {
+	items := []BatchItem{{Size: 40}, {Size: 40}, {Size: 30}, {Size: 100}, {Size: 10}}
+
+	groups := splitByMessageSize(items, 100)
+
+	expectedSizes := [][]int{{40, 40}, {30}, {100}, {10}}
+	if len(groups) != len(expectedSizes) {
+		t.Fatalf("Expected %d groups, got %d", len(expectedSizes), len(groups))
+	}
+
+	for i, group := range groups {
+		if len(group) != len(expectedSizes[i]) {
+			t.Fatalf("Expected group %d to have %d items, got %d", i, len(expectedSizes[i]), len(group))
+		}
+		for j, item := range group {
+			if item.Size != expectedSizes[i][j] {
+				t.Errorf("Expected group %d item %d size %d, got %d", i, j, expectedSizes[i][j], item.Size)
+			}
+		}
+	}
+}
+
+func Test_splitByMessageSize_should_keep_scd_pairs_in_one_group(t *testing.T) {
+	change := &versionChange{}
+	items := []BatchItem{
+		{Model: &mongodb.Raw{}, Size: 40},
+		{Model: &versionModel{change: change, open: true}, Size: 40},
+		{Model: &versionModel{change: change}, Size: 40},
+	}
+
+	groups := splitByMessageSize(items, 100)
+
+	if len(groups) != 2 || len(groups[0]) != 1 || len(groups[1]) != 2 {
+		t.Fatalf("Expected the open and close of a version in the same group, got %v", groups)
+	}
+}
+
+func Test_AddActions_should_measure_bson_size_and_reject_oversized_documents(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+
+	var failed []mongodb.DocumentFailedContext
+	bulk.hooks = mongodb.Hooks{
+		OnDocumentFailed: func(ctx mongodb.DocumentFailedContext) {
+			failed = append(failed, ctx)
+		},
+	}
+
+	document := bson.M{"_id": "doc1", "name": "test"}
+	oversized := bson.M{"_id": "doc2", "payload": strings.Repeat("a", MaxDocumentByteSize)}
+
+	acked := false
+	bulk.AddActions(&models.ListenerContext{Ack: func() { acked = true }}, time.Now(), []mongodb.Model{
+		&mongodb.Raw{ID: "doc1", Document: document, Operation: mongodb.Upsert},
+		&mongodb.Raw{ID: "doc2", Document: oversized, Operation: mongodb.Upsert},
+	}, "_default", 0)
+	p := bulk.partitions[0]
+
+	expected, _ := bson.Marshal(document)
+
+	if !acked {
+		t.Errorf("Expected event to be acked once it is added to the batch")
+	}
+
+	if len(p.batch) != 1 || p.batchByteSize != len(expected) {
+		t.Errorf("Expected one item of %d bytes, got %d items of %d bytes", len(expected), len(p.batch), p.batchByteSize)
+	}
+
+	if name, ok := p.batch[0].Bytes.Lookup("name").StringValueOK(); !ok || name != "test" {
+		t.Errorf("Expected batch item to hold the bson encoded document")
+	}
+
+	if len(failed) != 1 || failed[0].Collection != "testcollection" {
+		t.Errorf("Expected oversized document to be reported as failed, got %v", failed)
+	}
+}
+
+func Test_flushAndCommit_should_commit_only_when_no_batch_is_buffered_or_in_flight(t *testing.T) {
+	bulk := createTestBulkWithPartitions(t, 2)
+
+	var acks []int
+	var commits int
+	bulk.dcpCheckpointCommit = func() { commits++ }
+
+	for i := 0; i < 3; i++ {
+		seq := i
+		bulk.AddActions(&models.ListenerContext{Ack: func() { acks = append(acks, seq) }}, time.Now(), nil, "_default", uint16(i))
+	}
+
+	pending, err := bulk.partitions[0].handoff(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := <-pending.done; err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(acks) != 3 || acks[0] != 0 || acks[1] != 1 || acks[2] != 2 {
+		t.Errorf("Expected events acked in order as they are added, got %v", acks)
+	}
+	if commits != 0 {
+		t.Errorf("Expected no commit while partition 1 still buffers an event, got %d", commits)
+	}
+
+	if err := bulk.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if commits != 1 {
+		t.Errorf("Expected a commit once all partitions are flushed, got %d", commits)
+	}
+
+	if status := bulk.Status(); status.InFlight != 0 || status.BatchSize != 0 {
+		t.Errorf("Expected no buffered or in-flight batches, got %+v", status)
+	}
+}
+
+func Test_flushAndCommit_should_not_commit_after_a_failed_batch(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	bulk.partitions[0].writeErr = errors.New("bulk write failed")
+
+	var commits int
+	bulk.dcpCheckpointCommit = func() { commits++ }
+
+	if err := bulk.ForceFlush(context.Background()); err == nil {
+		t.Errorf("Expected the failure to be returned")
+	}
+
+	if commits != 0 {
+		t.Errorf("Expected no commit after a failed batch, got %d", commits)
+	}
+}
+
+// stallingSink blocks the writes until release is closed and signals started when the first write begins.
+type stallingSink struct {
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func newStallingSink() *stallingSink {
+	return &stallingSink{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (s *stallingSink) Write(ctx context.Context, _ []Write) error {
+	s.once.Do(func() { close(s.started) })
+
+	select {
+	case <-s.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func addTrackedEvent(bulk *Bulk, id string, offset *models.Offset) {
+	bulk.AddActions(&models.ListenerContext{Ack: func() { bulk.TrackOffset(0, offset) }}, time.Now(), []mongodb.Model{
+		&mongodb.Raw{ID: id, Document: bson.M{"_id": id}, Operation: mongodb.Upsert},
+	}, "_default", 0)
+}
+
+func Test_flushAndCommit_should_not_block_AddActions_while_a_batch_is_written(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	sink := newStallingSink()
+	bulk.sink = sink
+	bulk.isDryRunCommitted = true
+
+	var commits atomic.Int32
+	bulk.dcpCheckpointCommit = func() { commits.Add(1) }
+
+	addTrackedEvent(bulk, "doc1", &models.Offset{SeqNo: 1})
+
+	flushed := make(chan error, 1)
+	go func() { flushed <- bulk.ForceFlush(context.Background()) }()
+	<-sink.started
+
+	added := make(chan struct{})
+	go func() {
+		addTrackedEvent(bulk, "doc2", &models.Offset{SeqNo: 2})
+		close(added)
+	}()
+
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Fatal("Expected AddActions to proceed while the batch is written")
+	}
+
+	close(sink.release)
+	if err := <-flushed; err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if committed := bulk.offsets.committed[0]; commits.Load() != 1 || committed == nil || committed.SeqNo != 1 {
+		t.Errorf("Expected only the offset of the written batch committed, got %v after %d commits", committed, commits.Load())
+	}
+}
+
+type recordingMetadata struct {
+	metadata.Metadata
+	checkpoints  map[uint16]*models.CheckpointDocument
+	dirtyOffsets map[uint16]bool
+}
+
+func (m *recordingMetadata) Save(state map[uint16]*models.CheckpointDocument, dirtyOffsets map[uint16]bool, _ string) error {
+	m.checkpoints, m.dirtyOffsets = state, dirtyOffsets
+	return nil
+}
+
+func Test_CheckpointMetadata_should_save_only_the_committed_offsets(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	dcpMetadata := &recordingMetadata{}
+	checkpointMetadata := bulk.CheckpointMetadata(dcpMetadata)
+
+	bulk.commit(map[uint16]*models.Offset{0: {SeqNo: 5, SnapshotMarker: &models.SnapshotMarker{EndSeqNo: 5}}})
+
+	state := map[uint16]*models.CheckpointDocument{
+		0: newCheckpointDocument(&models.Offset{SeqNo: 9, SnapshotMarker: &models.SnapshotMarker{}}, "bucket"),
+		1: newCheckpointDocument(&models.Offset{SeqNo: 7, SnapshotMarker: &models.SnapshotMarker{}}, "bucket"),
+	}
+	if err := checkpointMetadata.Save(state, map[uint16]bool{0: true, 1: true}, "bucket"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(dcpMetadata.checkpoints) != 1 || dcpMetadata.checkpoints[0].Checkpoint.SeqNo != 5 || !dcpMetadata.dirtyOffsets[0] {
+		t.Errorf("Expected only the committed offset of vbucket 0 saved, got %v", dcpMetadata.checkpoints)
+	}
+
+	if err := checkpointMetadata.Save(state, map[uint16]bool{0: true}, "bucket"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if dcpMetadata.dirtyOffsets[0] || dcpMetadata.checkpoints[0].Checkpoint.SeqNo != 5 {
+		t.Errorf("Expected the saved offset to be kept and not saved again, got %v", dcpMetadata.checkpoints)
+	}
+}
+
+func Test_writeBatch_should_skip_batches_after_a_failure(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	p := bulk.partitions[0]
+	p.writeErr = errors.New("bulk write failed")
+
+	err := p.writeBatch(&pendingBatch{items: []BatchItem{{Model: &mongodb.Raw{ID: "doc1"}}}})
+
+	if err == nil || !errors.Is(err, p.writeErr) {
+		t.Errorf("Expected batch to fail with previous error, got %v", err)
+	}
+}
+
+func Test_AddActions_should_route_events_by_vbucket(t *testing.T) {
+	bulk := createTestBulkWithPartitions(t, 4)
+
+	for _, vbID := range []uint16{1, 5, 2} {
+		bulk.AddActions(&models.ListenerContext{Ack: func() {}}, time.Now(), []mongodb.Model{
+			&mongodb.Raw{ID: fmt.Sprintf("doc%d", vbID), Document: bson.M{"_id": vbID}, Operation: mongodb.Upsert},
+		}, "_default", vbID)
+	}
+
+	expectedSizes := []int{0, 2, 1, 0}
+	for i, p := range bulk.partitions {
+		if p.batchSize != expectedSizes[i] {
+			t.Errorf("Expected partition %d to have %d items, got %d", i, expectedSizes[i], p.batchSize)
+		}
+	}
+
+	if status := bulk.Status(); status.BatchSize != 3 || status.Partitions != 4 {
+		t.Errorf("Expected 3 buffered items over 4 partitions, got %+v", status)
+	}
+}
+
+func Test_adaptiveController_should_adjust_limits_within_bounds(t *testing.T) {
+	controller := newAdaptiveController(config.AdaptiveBatchConfig{
+		Enabled:              true,
+		MinSizeLimit:         10,
+		MaxSizeLimit:         120,
+		MinConcurrentRequest: 1,
+		MaxConcurrentRequest: 3,
+		TargetLatency:        time.Second,
+		MaxErrorRate:         0.1,
+		Window:               2,
+	}, 100, 2, metric.NewMetricsRecorder())
+
+	controller.observe(100*time.Millisecond, 10, nil)
+	if controller.SizeLimit() != 100 || controller.Concurrency() != 2 {
+		t.Errorf("Expected limits to change only after a full window, got %d/%d", controller.SizeLimit(), controller.Concurrency())
+	}
+
+	controller.observe(100*time.Millisecond, 10, nil)
+	if controller.SizeLimit() != 120 || controller.Concurrency() != 3 {
+		t.Errorf("Expected limits to grow up to max bounds, got %d/%d", controller.SizeLimit(), controller.Concurrency())
+	}
+
+	controller.observe(700*time.Millisecond, 10, nil)
+	controller.observe(700*time.Millisecond, 10, nil)
+	if controller.SizeLimit() != 120 || controller.Concurrency() != 3 {
+		t.Errorf("Expected limits to hold near target latency, got %d/%d", controller.SizeLimit(), controller.Concurrency())
+	}
+
+	controller.recordFailures(5)
+	controller.observe(100*time.Millisecond, 10, nil)
+	controller.observe(100*time.Millisecond, 10, nil)
+	if controller.SizeLimit() != 60 || controller.Concurrency() != 2 {
+		t.Errorf("Expected limits to shrink on high error rate, got %d/%d", controller.SizeLimit(), controller.Concurrency())
+	}
+
+	for range 3 {
+		controller.observe(2*time.Second, 10, nil)
+		controller.observe(2*time.Second, 10, errors.New("timeout"))
+	}
+	if controller.SizeLimit() != 10 || controller.Concurrency() != 1 {
+		t.Errorf("Expected limits to shrink down to min bounds, got %d/%d", controller.SizeLimit(), controller.Concurrency())
+	}
+}
+
+func Test_AddActions_should_use_adaptive_size_limit(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	bulk.adaptive = newAdaptiveController(config.AdaptiveBatchConfig{
+		MinSizeLimit: 2, MaxSizeLimit: 2, MinConcurrentRequest: 1, MaxConcurrentRequest: 1, Window: 1,
+	}, bulk.batchSizeLimit, bulk.concurrentRequest, bulk.metricsRecorder)
+
+	if status := bulk.Status(); status.SizeLimit != 2 || status.ConcurrentRequest != 1 {
+		t.Errorf("Expected adaptive limits in status, got %+v", status)
+	}
+
+	p := bulk.partitions[0]
+	for i := range 2 {
+		p.add(BatchItem{Model: &mongodb.Raw{ID: fmt.Sprintf("doc%d", i), MongoCollection: "testcollection"}})
+	}
+
+	if !p.isFull() {
+		t.Errorf("Expected partition to be full at adaptive size limit, got %d items", p.batchSize)
+	}
+}
+
+func Test_waitForBuffer_should_block_while_buffer_limit_is_reached(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	bulk.maxBufferedDocuments = 2
+	bulk.addBuffered(2, 100)
+
+	released := make(chan struct{})
+	go func() {
+		bulk.waitForBuffer()
+		close(released)
+	}()
+
+	select {
+	case <-released:
+		t.Fatalf("Expected listener to block while buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	bulk.releaseBuffered(1, 50)
+
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected listener to resume once buffered documents are written")
+	}
+}
+
+func Test_waitForBuffer_should_return_when_bulk_is_closed(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	bulk.maxBufferedBytes = 10
+	bulk.addBuffered(1, 10)
+
+	released := make(chan struct{})
+	go func() {
+		bulk.waitForBuffer()
+		close(released)
+	}()
+
+	bulk.closeBuffer()
+
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected blocked listener to be released on close")
+	}
+}
+
+func Test_AddActions_should_track_buffered_documents(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+
+	for _, id := range []string{"doc1", "doc2", "doc1"} {
+		bulk.AddActions(&models.ListenerContext{Ack: func() {}}, time.Now(), []mongodb.Model{
+			&mongodb.Raw{ID: id, Document: bson.M{"_id": id}, Operation: mongodb.Upsert},
+		}, "_default", 0)
+	}
+
+	status := bulk.Status()
+	if status.BufferedDocuments != 2 || status.BufferedBytes != bulk.partitions[0].batchByteSize {
+		t.Errorf("Expected 2 buffered documents of %d bytes, got %+v", bulk.partitions[0].batchByteSize, status)
+	}
+}
+
+func Test_chunkItems_should_keep_ordered_collections_in_a_single_chunk(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	bulk.collectionOptions = map[string]config.CollectionOptions{"ordered": {Ordered: true}}
+
+	itemsOf := func(collection string) []BatchItem {
+		items := make([]BatchItem, 4)
+		for i := range items {
+			items[i] = BatchItem{Model: &mongodb.Raw{ID: fmt.Sprintf("doc%d", i), MongoCollection: collection}}
+		}
+		return items
+	}
+
+	if chunks := bulk.chunkItems(itemsOf("ordered")); len(chunks) != 1 || len(chunks[0]) != 4 {
+		t.Errorf("Expected ordered collection items in a single chunk, got %d chunks", len(chunks))
+	}
+
+	if chunks := bulk.chunkItems(itemsOf("testcollection")); len(chunks) != bulk.concurrentRequest {
+		t.Errorf("Expected %d chunks for unordered collection, got %d", bulk.concurrentRequest, len(chunks))
+	}
+}
+
+func Test_requestChunks_should_keep_an_ordered_collection_in_a_single_chunk_within_a_mixed_batch(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	bulk.collectionOptions = map[string]config.CollectionOptions{"testcollection_history": {Ordered: true}}
+
+	var batch []BatchItem
+	for i := 0; i < 4; i++ {
+		batch = append(batch,
+			BatchItem{Model: &mongodb.Raw{ID: fmt.Sprintf("doc%d", i), MongoCollection: "testcollection"}},
+			BatchItem{Model: &historyRecord{history: "testcollection_history"}},
+		)
+	}
+
+	chunks := bulk.requestChunks(batch)
+
+	var historyChunks int
+	for _, chunk := range chunks {
+		collection, _ := collectionOf(chunk[0].Model)
+		for _, item := range chunk {
+			if itemCollection, _ := collectionOf(item.Model); itemCollection != collection {
+				t.Fatalf("Expected chunks of a single collection, got %s and %s", collection, itemCollection)
+			}
+		}
+		if collection == "testcollection_history" {
+			historyChunks++
+			if len(chunk) != 4 {
+				t.Errorf("Expected all history records in the chunk, got %d", len(chunk))
+			}
+		}
+	}
+
+	if historyChunks != 1 || len(chunks) != 1+bulk.concurrentRequest {
+		t.Errorf("Expected a history chunk and %d chunks for testcollection, got %d chunks", bulk.concurrentRequest, len(chunks))
+	}
+}
+
+func Test_eventTransactions_should_group_items_by_event_in_event_order(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+
+	for i, id := range []string{"order1", "order2", "order1"} {
+		lineID := fmt.Sprintf("line%d", i)
+		bulk.AddActions(&models.ListenerContext{Ack: func() {}}, time.Now(), []mongodb.Model{
+			&mongodb.Raw{ID: id, Document: bson.M{"_id": id}, Operation: mongodb.Upsert},
+			&mongodb.Raw{ID: lineID, Document: bson.M{"_id": lineID, "orderId": id}, Operation: mongodb.Upsert},
+		}, "_default", 0)
+	}
+
+	groups := eventTransactions(bulk.partitions[0].batch)
+
+	if len(groups) != 3 || len(groups[0]) != 1 || len(groups[1]) != 2 || len(groups[2]) != 2 {
+		t.Fatalf("Expected transactions of 1, 2 and 2 items, got %v", groups)
+	}
+	for i, group := range groups {
+		for _, item := range group {
+			if item.Event != i {
+				t.Errorf("Expected transaction %d to hold the items of event %d, got event %d", i, i, item.Event)
+			}
+		}
+	}
+}
+
+func Test_runTransactions_should_retry_a_rejected_batch_per_event(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	bulk.transaction = config.Transaction{Scope: config.TransactionScopeBatch}
+
+	var failed []mongodb.DocumentFailedContext
+	bulk.hooks = mongodb.Hooks{
+		OnDocumentFailed: func(ctx mongodb.DocumentFailedContext) {
+			failed = append(failed, ctx)
+		},
+	}
+
+	for _, id := range []string{"order1", "order2"} {
+		bulk.AddActions(&models.ListenerContext{Ack: func() {}}, time.Now(), []mongodb.Model{
+			&mongodb.Raw{ID: id, Document: bson.M{"_id": id}, Operation: mongodb.Upsert},
+			&mongodb.Raw{ID: id + "-line", Document: bson.M{"_id": id + "-line"}, Operation: mongodb.Upsert},
+		}, "_default", 0)
+	}
+
+	rejectedErr := mongo.BulkWriteError{WriteError: mongo.WriteError{Index: 1, Code: 121, Message: "validation failed"}}
+
+	var written [][]string
+	err := bulk.runTransactions(context.Background(), bulk.partitions[0].batch, func(_ context.Context, items []BatchItem) error {
+		var ids []string
+		for _, item := range items {
+			ids = append(ids, item.Model.(*mongodb.Raw).ID)
+		}
+		written = append(written, ids)
+
+		for i, id := range ids {
+			if id == "order2-line" {
+				writeErr := rejectedErr
+				writeErr.Index = i
+				return &rejectedTransaction{collection: "testcollection", writeErrors: []mongo.BulkWriteError{writeErr}}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected rejected documents to be dead-lettered, got %v", err)
+	}
+
+	if len(written) != 3 || len(written[0]) != 4 || written[1][0] != "order1" || written[2][0] != "order2" {
+		t.Fatalf("Expected the batch and then each event in order, got %v", written)
+	}
+
+	if len(failed) != 2 {
+		t.Fatalf("Expected the items of the rejected event to be dead-lettered, got %v", failed)
+	}
+	for _, ctx := range failed {
+		switch ctx.Model.(*mongodb.Raw).ID {
+		case "order2-line":
+			if ctx.Code != 121 {
+				t.Errorf("Expected the rejected document to get its error, got %v", ctx.Err)
+			}
+		case "order2":
+			if !errors.Is(ctx.Err, ErrTransactionAborted) || ctx.Code != 0 {
+				t.Errorf("Expected the other document to get the abort error, got %v", ctx.Err)
+			}
+		default:
+			t.Errorf("Expected documents of other events not to be dead-lettered, got %v", ctx.Model)
+		}
+	}
+}
+
+func Test_runTransactions_should_fail_on_transaction_errors(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	bulk.transaction = config.Transaction{Scope: config.TransactionScopeEvent}
+
+	bulk.AddActions(&models.ListenerContext{Ack: func() {}}, time.Now(), []mongodb.Model{
+		&mongodb.Raw{ID: "order1", Document: bson.M{"_id": "order1"}, Operation: mongodb.Upsert},
+	}, "_default", 0)
+
+	transactionErr := errors.New("transaction timed out")
+	err := bulk.runTransactions(context.Background(), bulk.partitions[0].batch, func(context.Context, []BatchItem) error {
+		return transactionErr
+	})
+
+	if !errors.Is(err, transactionErr) {
+		t.Errorf("Expected the transaction error, got %v", err)
+	}
+}
+
+func Test_AddActions_should_not_deduplicate_filter_models(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+
+	deleteChildren := func() mongodb.Model {
+		return &mongodb.DeleteMany{Filter: bson.M{"parentId": "parent1"}}
+	}
+	updateChildren := &mongodb.UpdateMany{Filter: bson.M{"parentId": "parent1"}, Update: bson.M{"$set": bson.M{"orphan": true}}}
+
+	bulk.AddActions(&models.ListenerContext{Ack: func() {}}, time.Now(), []mongodb.Model{
+		deleteChildren(), updateChildren, deleteChildren(),
+	}, "_default", 0)
+	p := bulk.partitions[0]
+
+	if p.batchSize != 3 {
+		t.Fatalf("Expected filter models not to be deduplicated, got %d items", p.batchSize)
+	}
+
+	if collection, _ := collectionOf(p.batch[1].Model); collection != "testcollection" {
+		t.Errorf("Expected collection to be set from collection mapping, got %s", collection)
+	}
+
+	if _, ok := bulk.buildWriteModel(p.batch[0]).(*mongo.DeleteManyModel); !ok {
+		t.Errorf("Expected DeleteMany to build a DeleteManyModel")
+	}
+
+	updateModel, ok := bulk.buildWriteModel(p.batch[1]).(*mongo.UpdateManyModel)
+	if !ok || updateModel.Filter.(bson.M)["parentId"] != "parent1" {
+		t.Errorf("Expected UpdateMany to build an UpdateManyModel with its filter, got %+v", updateModel)
+	}
+}
+
+func Test_AddActions_should_keep_writes_of_a_document_on_both_sides_of_a_filter_model(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+
+	upsertChild := func(version int) []mongodb.Model {
+		return []mongodb.Model{&mongodb.Raw{
+			ID: "child1", Document: bson.M{"_id": "child1", "parentId": "parent1", "version": version}, Operation: mongodb.Upsert,
+		}}
+	}
+
+	bulk.AddActions(&models.ListenerContext{Ack: func() {}}, time.Now(), upsertChild(1), "_default", 0)
+	bulk.AddActions(&models.ListenerContext{Ack: func() {}}, time.Now(), []mongodb.Model{
+		&mongodb.DeleteMany{Filter: bson.M{"parentId": "parent1"}},
+	}, "_default", 0)
+	bulk.AddActions(&models.ListenerContext{Ack: func() {}}, time.Now(), upsertChild(2), "_default", 0)
+
+	batch := bulk.partitions[0].batch
+	if len(batch) != 3 {
+		t.Fatalf("Expected the upsert after the DeleteMany not to replace the one before it, got %d items", len(batch))
+	}
+
+	if _, ok := batch[1].Model.(*mongodb.DeleteMany); !ok || batch[2].Model.(*mongodb.Raw).Document["version"] != 2 {
+		t.Errorf("Expected the second upsert to follow the DeleteMany, got %v", batch)
+	}
+
+	if runs := collectionRuns(batch); len(runs) != 1 || len(runs[0]) != 3 {
+		t.Errorf("Expected the batch written as a single ordered run, got %v", runs)
+	}
+}
+
+func Test_collectionRuns_should_split_consecutive_items_by_collection(t *testing.T) {
+	raw := func(collection string) BatchItem {
+		return BatchItem{Model: &mongodb.Raw{MongoCollection: collection}}
+	}
+	batch := []BatchItem{raw("users"), raw("users"), raw("orders"), raw("users")}
+
+	runs := collectionRuns(batch)
+
+	if len(runs) != 3 || len(runs[0]) != 2 || len(runs[1]) != 1 || len(runs[2]) != 1 {
+		t.Errorf("Expected three runs in batch order, got %v", runs)
+	}
+}
+
+func Test_retryDelay_should_double_up_to_the_maximum(t *testing.T) {
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}
+	for i, delay := range expected {
+		if actual := retryDelay(i + 1); actual != delay {
+			t.Errorf("Expected delay %v for attempt %d, got %v", delay, i+1, actual)
+		}
+	}
+
+	if actual := retryDelay(100); actual != maxRetryBackoff {
+		t.Errorf("Expected delay capped at %v, got %v", maxRetryBackoff, actual)
+	}
+}
+
+func Test_waitRetry_should_stop_when_the_context_is_done(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	startedTime := time.Now()
+	if err := waitRetry(ctx, 10); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context canceled, got %v", err)
+	}
+	if time.Since(startedTime) >= maxRetryBackoff {
+		t.Errorf("Expected the wait to stop with the context")
+	}
+}
+
+func Test_recordSuccess_should_count_modified_and_matched_documents_apart(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+
+	bulk.recordSuccess("test", &mongo.BulkWriteResult{MatchedCount: 5, ModifiedCount: 2, UpsertedCount: 1, DeletedCount: 7})
+	bulk.recordErrors("test", []mongo.WriteModel{mongo.NewReplaceOneModel(), mongo.NewDeleteManyModel()})
+
+	stats := bulk.Status().Collections["test"]
+	if stats.UpdateSuccess != 3 || stats.UpdateMatched != 5 || stats.DeleteSuccess != 7 || stats.UpdateError != 1 || stats.DeleteError != 1 {
+		t.Errorf("Unexpected collection stats %+v", stats)
+	}
+}
+
+func Test_buildWriteModel_should_translate_pipeline_update(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+
+	pipeline := []bson.D{{{Key: "$set", Value: bson.M{"summary": bson.M{"$mergeObjects": bson.A{"$summary", bson.M{"total": 5}}}}}}}
+	model := &mongodb.PipelineUpdate{
+		ID:        "order1",
+		Pipeline:  pipeline,
+		Upsert:    true,
+		Collation: &options.Collation{Locale: "en"},
+		Hint:      "customerId_1",
+	}
+
+	bulk.AddActions(&models.ListenerContext{Ack: func() {}}, time.Now(), []mongodb.Model{model, model}, "_default", 0)
+	p := bulk.partitions[0]
+
+	if p.batchSize != 2 {
+		t.Fatalf("Expected pipeline updates not to be deduplicated, got %d items", p.batchSize)
+	}
+
+	updateModel, ok := bulk.buildWriteModel(p.batch[0]).(*mongo.UpdateOneModel)
+	if !ok {
+		t.Fatalf("Expected pipeline update to build an UpdateOneModel")
+	}
+
+	if updateModel.Filter.(bson.M)["_id"] != "order1" || updateModel.Upsert == nil || !*updateModel.Upsert {
+		t.Errorf("Expected upsert filter on _id, got %+v", updateModel)
+	}
+
+	if len(updateModel.Update.([]bson.D)) != 1 || updateModel.ArrayFilters != nil {
+		t.Errorf("Expected the pipeline to be set without array filters, got %+v", updateModel)
+	}
+
+	if updateModel.Collation.Locale != "en" || updateModel.Hint != "customerId_1" {
+		t.Errorf("Expected collation and hint to be set, got %+v", updateModel)
+	}
+}
+
+func Test_buildMergeUpdate_should_set_flattened_paths(t *testing.T) {
+	document := bson.M{
+		"_id":     "doc1",
+		"name":    "test",
+		"address": map[string]any{"city": "Istanbul", "geo": bson.M{"lat": 41}},
+		"tags":    bson.A{"a", "b"},
+		"removed": nil,
+	}
+
+	update := buildMergeUpdate(document, config.MergeOptions{})
+	expected := bson.M{"$set": bson.M{
+		"name": "test", "address.city": "Istanbul", "address.geo.lat": 41, "tags": bson.A{"a", "b"}, "removed": nil,
+	}}
+	if fmt.Sprint(update) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, update)
+	}
+
+	update = buildMergeUpdate(document, config.MergeOptions{
+		NullFields: config.MergeNullFieldsUnset,
+		Arrays:     config.MergeArraysAddToSet,
+	})
+	expected = bson.M{
+		"$set":      bson.M{"name": "test", "address.city": "Istanbul", "address.geo.lat": 41},
+		"$unset":    bson.M{"removed": ""},
+		"$addToSet": bson.M{"tags": bson.M{"$each": bson.A{"a", "b"}}},
+	}
+	if fmt.Sprint(update) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, update)
+	}
+}
+
+func Test_AddActions_should_combine_merges_of_the_same_document(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	bulk.collectionOptions = map[string]config.CollectionOptions{"testcollection": {Merge: config.MergeOptions{Default: true}}}
+
+	bulk.AddActions(&models.ListenerContext{Ack: func() {}}, time.Now(), []mongodb.Model{
+		&mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1", "order": bson.M{"id": 1}}, Operation: mongodb.Upsert},
+		&mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1", "payment": bson.M{"id": 2}}, Operation: mongodb.Merge},
+	}, "_default", 0)
+	p := bulk.partitions[0]
+
+	if p.batchSize != 1 {
+		t.Fatalf("Expected merges of one document to be combined, got %d items", p.batchSize)
+	}
+
+	updateModel, ok := bulk.buildWriteModel(p.batch[0]).(*mongo.UpdateOneModel)
+	if !ok {
+		t.Fatalf("Expected merge to build an UpdateOneModel")
+	}
+
+	set := updateModel.Update.(bson.M)["$set"].(bson.M)
+	if set["order.id"] != 1 || set["payment.id"] != 2 || updateModel.Filter.(bson.M)["_id"] != "doc1" {
+		t.Errorf("Expected fields of both merges to be set, got %v", updateModel.Update)
+	}
+
+	if p.batchByteSize != p.batch[0].Size {
+		t.Errorf("Expected batch byte size %d to match combined item size %d", p.batchByteSize, p.batch[0].Size)
+	}
+}
+
+func Test_AddActions_should_replace_a_deleted_document_merged_again(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	bulk.collectionOptions = map[string]config.CollectionOptions{"testcollection": {Merge: config.MergeOptions{Default: true}}}
+
+	bulk.AddActions(&models.ListenerContext{Ack: func() {}}, time.Now(), []mongodb.Model{
+		&mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1"}, Operation: mongodb.Delete},
+		&mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1", "name": "recreated"}, Operation: mongodb.Upsert},
+	}, "_default", 0)
+	p := bulk.partitions[0]
+
+	if p.batchSize != 1 {
+		t.Fatalf("Expected one item for the document, got %d", p.batchSize)
+	}
+
+	replaceModel, ok := bulk.buildWriteModel(p.batch[0]).(*mongo.ReplaceOneModel)
+	if !ok {
+		t.Fatalf("Expected the merge after a delete to build a ReplaceOneModel, got %T", bulk.buildWriteModel(p.batch[0]))
+	}
+
+	var replacement bson.M
+	_ = bson.Unmarshal(replaceModel.Replacement.(bson.Raw), &replacement)
+	if len(replacement) != 2 || replacement["name"] != "recreated" {
+		t.Errorf("Expected the merge document as replacement, got %v", replacement)
+	}
+}
+
+func Test_AddActions_should_merge_into_an_earlier_replacement(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	bulk.collectionOptions = map[string]config.CollectionOptions{
+		"testcollection": {Merge: config.MergeOptions{NullFields: config.MergeNullFieldsUnset}},
+	}
+
+	bulk.AddActions(&models.ListenerContext{Ack: func() {}}, time.Now(), []mongodb.Model{
+		&mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1", "order": bson.M{"id": 1, "note": "a"}}, Operation: mongodb.Upsert},
+		&mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1", "order": bson.M{"note": nil}, "payment": 2}, Operation: mongodb.Merge},
+	}, "_default", 0)
+	p := bulk.partitions[0]
+
+	replaceModel, ok := bulk.buildWriteModel(p.batch[0]).(*mongo.ReplaceOneModel)
+	if p.batchSize != 1 || !ok {
+		t.Fatalf("Expected one ReplaceOneModel, got %d items", p.batchSize)
+	}
+
+	var replacement bson.M
+	_ = bson.Unmarshal(replaceModel.Replacement.(bson.Raw), &replacement)
+	order, _ := replacement["order"].(bson.M)
+	if replacement["payment"] != int32(2) || order["id"] != int32(1) || len(order) != 1 {
+		t.Errorf("Expected the merge applied to the replacement without the unset field, got %v", replacement)
+	}
+}
+
+func Test_handleWriteErrors_should_apply_duplicate_key_policy(t *testing.T) {
+	duplicateKeyErr := mongo.BulkWriteError{WriteError: mongo.WriteError{Index: 0, Code: duplicateKeyErrorCode, Message: "E11000"}}
+	items := []BatchItem{{Model: &mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1"}, Operation: mongodb.Insert}}}
+
+	tests := []struct {
+		policy         string
+		expectedFailed int
+		expectErr      bool
+	}{
+		{policy: config.DuplicateKeyPolicyIgnore},
+		{policy: "", expectedFailed: 1},
+		{policy: config.DuplicateKeyPolicyDeadLetter, expectedFailed: 1},
+		{policy: config.DuplicateKeyPolicyFail, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			bulk := createTestBulkWithoutConnection(t)
+			bulk.collectionOptions = map[string]config.CollectionOptions{"test": {DuplicateKeyPolicy: tt.policy}}
+
+			var failed int
+			bulk.hooks.OnDocumentFailed = func(ctx mongodb.DocumentFailedContext) { failed++ }
+
+			err := bulk.handleWriteErrors(context.Background(), "test", items, []mongo.BulkWriteError{duplicateKeyErr})
+
+			if (err != nil) != tt.expectErr {
+				t.Errorf("Expected error %v, got %v", tt.expectErr, err)
+			}
+
+			if failed != tt.expectedFailed {
+				t.Errorf("Expected %d failed documents, got %d", tt.expectedFailed, failed)
+			}
+		})
+	}
+}
+
+func Test_buildWriteModel_should_build_insert_model_for_insert(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+
+	model := bulk.buildWriteModel(BatchItem{Model: &mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1"}, Operation: mongodb.Insert}})
+	if _, ok := model.(*mongo.InsertOneModel); !ok {
+		t.Errorf("Expected insert to build an InsertOneModel, got %T", model)
+	}
+}
+
+func Test_AddActions_should_add_history_records(t *testing.T) {
+	tests := []struct {
+		name          string
+		only          bool
+		expectedItems int
+	}{
+		{name: "current state and history", expectedItems: 2},
+		{name: "history only", only: true, expectedItems: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bulk := createTestBulkWithoutConnection(t)
+			bulk.collectionOptions = map[string]config.CollectionOptions{
+				"testcollection": {History: config.HistoryOptions{Enabled: true, Only: tt.only}},
+			}
+
+			bulk.AddActions(&models.ListenerContext{Ack: func() {}}, time.Now(), []mongodb.Model{
+				&mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1", "name": "test"}, Operation: mongodb.Upsert},
+			}, "_default", 0)
+			p := bulk.partitions[0]
+
+			if p.batchSize != tt.expectedItems {
+				t.Fatalf("Expected %d items, got %d", tt.expectedItems, p.batchSize)
+			}
+
+			record, ok := p.batch[p.batchSize-1].Model.(*historyRecord)
+			if !ok {
+				t.Fatalf("Expected last item to be a history record, got %T", p.batch[p.batchSize-1].Model)
+			}
+
+			if record.history != "testcollection_history" || record.documentID != "doc1" {
+				t.Errorf("Expected history of doc1 in testcollection_history, got %s of %v", record.history, record.documentID)
+			}
+
+			if _, ok := bulk.buildWriteModel(p.batch[p.batchSize-1]).(*mongo.InsertOneModel); !ok {
+				t.Errorf("Expected history record to build an InsertOneModel")
+			}
+		})
+	}
+}
+
+func Test_diffDocuments_should_return_changed_and_removed_paths(t *testing.T) {
+	previous := bson.M{"_id": "doc1", "name": "old", "address": bson.M{"city": "Istanbul", "zip": "34000"}, "removed": true}
+	document := bson.M{"_id": "doc1", "name": "new", "address": bson.M{"city": "Istanbul"}, "added": 1}
+
+	diff := diffDocuments(previous, document)
+
+	expectedSet := bson.M{"name": "new", "added": 1}
+	if fmt.Sprint(diff["set"]) != fmt.Sprint(expectedSet) {
+		t.Errorf("Expected set %v, got %v", expectedSet, diff["set"])
+	}
+
+	unset := diff["unset"].(bson.A)
+	if len(unset) != 2 {
+		t.Errorf("Expected address.zip and removed to be unset, got %v", unset)
+	}
+}
+
+func Test_AddActions_should_write_scd_version_pairs(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	scd := config.SCDOptions{Enabled: true, ValidFromField: "validFrom", ValidToField: "validTo", VersionField: "version"}
+	bulk.collectionOptions = map[string]config.CollectionOptions{"testcollection": {SCD: scd}}
+
+	eventTime := time.Unix(0, 42)
+	bulk.AddActions(&models.ListenerContext{Ack: func() {}}, eventTime, []mongodb.Model{
+		&mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1", "name": "test"}, Operation: mongodb.Upsert},
+		&mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1"}, Operation: mongodb.Delete},
+	}, "_default", 0)
+	p := bulk.partitions[0]
+
+	if p.batchSize != 3 {
+		t.Fatalf("Expected open and close for the upsert and close for the delete, got %d items", p.batchSize)
+	}
+
+	openModel, ok := bulk.buildWriteModel(p.batch[0]).(*mongo.UpdateOneModel)
+	if !ok || openModel.Upsert == nil || !*openModel.Upsert {
+		t.Fatalf("Expected opening a version to build an upserting UpdateOneModel, got %T", bulk.buildWriteModel(p.batch[0]))
+	}
+	if id := openModel.Filter.(bson.M)["_id"]; !reflect.DeepEqual(id, versionID("doc1", 42)) {
+		t.Errorf("Expected the version to be identified by the event, got %v", id)
+	}
+	if _, ok := openModel.Update.(bson.M)["$setOnInsert"]; !ok {
+		t.Errorf("Expected a replayed version not to be written again, got %v", openModel.Update)
+	}
+
+	closeModel, ok := bulk.buildWriteModel(p.batch[1]).(*mongo.UpdateManyModel)
+	if !ok {
+		t.Fatalf("Expected closing a version to build an UpdateManyModel, got %T", bulk.buildWriteModel(p.batch[1]))
+	}
+	if filter := closeModel.Filter.(bson.M); filter["_id.id"] != "doc1" || filter["_id.cas"].(bson.M)["$lt"] != int64(42) {
+		t.Errorf("Expected close filter on the versions of doc1 before the change, got %v", closeModel.Filter)
+	}
+
+	if !p.batch[0].Model.(*versionModel).closes(p.batch[1].Model) || p.batch[0].Model.(*versionModel).closes(p.batch[2].Model) {
+		t.Errorf("Expected the open to be followed by the close of its own change")
+	}
+
+	if !bulk.isOrdered("testcollection") {
+		t.Errorf("Expected SCD collections to be written ordered")
+	}
+}
+
+func Test_numberVersions_should_chain_versions_within_a_batch(t *testing.T) {
+	first, second := time.Unix(100, 0), time.Unix(200, 0)
+	changes := []*versionChange{
+		{documentID: "doc1", eventTime: first},
+		{documentID: "doc2", eventTime: first},
+		{documentID: "doc1", eventTime: second},
+		{documentID: "doc2", eventTime: second, deleted: true},
+	}
+
+	numberVersions(changes, map[string]int64{"doc1": 3})
+
+	if changes[0].version != 4 || changes[2].version != 5 || changes[1].version != 1 {
+		t.Errorf("Expected versions 4, 1 and 5, got %d, %d and %d", changes[0].version, changes[1].version, changes[2].version)
+	}
+
+	if changes[0].closedAt == nil || !changes[0].closedAt.Equal(second) || changes[2].closedAt != nil {
+		t.Errorf("Expected only the first version of doc1 to be closed by the second")
+	}
+
+	if changes[1].closedAt == nil || changes[3].version != 2 {
+		t.Errorf("Expected the deletion to close version 1 of doc2, got version %d", changes[3].version)
+	}
+}
+
+func Test_verifyTimeSeriesCollections_should_fail_unless_every_collection_is_timeseries(t *testing.T) {
+	tests := []struct {
+		name           string
+		specifications []*mongo.CollectionSpecification
+		errMsg         string
+	}{
+		{
+			name:           "timeseries",
+			specifications: []*mongo.CollectionSpecification{{Name: "metrics", Type: "timeseries"}},
+		},
+		{
+			name:   "missing",
+			errMsg: "time-series collection metrics does not exist, enable provisioning or create it",
+		},
+		{
+			name:           "regular collection",
+			specifications: []*mongo.CollectionSpecification{{Name: "metrics", Type: "collection"}},
+			errMsg:         "collection metrics is configured as time-series but is of type collection",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyTimeSeriesCollections([]string{"metrics"}, tt.specifications)
+			if tt.errMsg == "" && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if tt.errMsg != "" && (err == nil || err.Error() != tt.errMsg) {
+				t.Errorf("Expected error %q, got %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func Test_AddActions_should_insert_measurements_into_timeseries_collections(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	bulk.collectionOptions = map[string]config.CollectionOptions{
+		"testcollection": {TimeSeries: config.TimeSeriesOptions{Enabled: true, TimeField: "ts", SourceField: "createdAt"}},
+	}
+
+	var failed int
+	bulk.hooks.OnDocumentFailed = func(ctx mongodb.DocumentFailedContext) { failed++ }
+
+	eventTime := time.Unix(1700000000, 0)
+	bulk.AddActions(&models.ListenerContext{Ack: func() {}}, eventTime, []mongodb.Model{
+		&mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1", "createdAt": "2024-01-02T03:04:05Z"}, Operation: mongodb.Upsert},
+		&mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1", "createdAt": float64(1704164645000)}, Operation: mongodb.Upsert},
+		&mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1"}, Operation: mongodb.Upsert},
+		&mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1", "createdAt": true}, Operation: mongodb.Upsert},
+		&mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1"}, Operation: mongodb.Delete},
+	}, "_default", 0)
+	p := bulk.partitions[0]
+
+	if p.batchSize != 3 || failed != 1 {
+		t.Fatalf("Expected 3 measurements and 1 rejected document, got %d and %d", p.batchSize, failed)
+	}
+
+	expected := []time.Time{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), time.UnixMilli(1704164645000), eventTime}
+	for i, item := range p.batch {
+		insertModel, ok := bulk.buildWriteModel(item).(*mongo.InsertOneModel)
+		if !ok {
+			t.Fatalf("Expected measurement to build an InsertOneModel")
+		}
+
+		if ts := insertModel.Document.(bson.M)["ts"].(time.Time); !ts.Equal(expected[i]) {
+			t.Errorf("Expected time %v, got %v", expected[i], ts)
+		}
+	}
+}
+
+func Test_indexName_should_match_mongodb_generated_names(t *testing.T) {
+	tests := []struct {
+		index    config.IndexOptions
+		expected string
+	}{
+		{index: config.IndexOptions{Keys: []config.IndexKey{{Field: "name"}}}, expected: "name_1"},
+		{index: config.IndexOptions{Keys: []config.IndexKey{{Field: "a"}, {Field: "b", Direction: -1}}}, expected: "a_1_b_-1"},
+		{index: config.IndexOptions{Keys: []config.IndexKey{{Field: "location", Type: config.IndexType2DSphere}}}, expected: "location_2dsphere"},
+		{index: config.IndexOptions{Name: "custom", Keys: []config.IndexKey{{Field: "name"}}}, expected: "custom"},
+	}
+
+	for _, tt := range tests {
+		if name := indexName(tt.index); name != tt.expected {
+			t.Errorf("Expected index name %s, got %s", tt.expected, name)
+		}
+	}
+}
+
+func Test_indexDifference_should_report_differences_that_need_a_recreate(t *testing.T) {
+	partialFilter, _ := bson.Marshal(bson.D{{Key: "status", Value: "active"}, {Key: "age", Value: bson.M{"$gt": 18}}})
+	ttl := int64(60)
+	current := &existingIndex{
+		Name:                    "email_1",
+		Key:                     bson.D{{Key: "email", Value: int32(1)}},
+		Unique:                  true,
+		PartialFilterExpression: partialFilter,
+		ExpireAfterSeconds:      &ttl,
+	}
+	desired := config.IndexOptions{
+		Keys:          []config.IndexKey{{Field: "email"}},
+		Unique:        true,
+		PartialFilter: map[string]any{"age": map[string]any{"$gt": 18}, "status": "active"},
+		ExpireAfter:   2 * time.Minute,
+	}
+
+	if difference := indexDifference(desired, current); difference != "" {
+		t.Errorf("Expected no difference, got %s", difference)
+	}
+
+	desired.Unique = false
+	if difference := indexDifference(desired, current); difference != "unique" {
+		t.Errorf("Expected unique difference, got %s", difference)
+	}
+
+	desired.Unique = true
+	desired.Keys = []config.IndexKey{{Field: "email", Direction: -1}}
+	if difference := indexDifference(desired, current); difference != "keys" {
+		t.Errorf("Expected keys difference, got %s", difference)
+	}
+}
+
+func Test_desiredIndexes_should_include_history_and_scd_indexes(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	bulk.collectionOptions = map[string]config.CollectionOptions{
+		"orders": {
+			Indexes: []config.IndexOptions{{Keys: []config.IndexKey{{Field: "customerId"}}}},
+			History: config.HistoryOptions{Enabled: true, Retention: time.Hour},
+			SCD:     config.SCDOptions{Enabled: true},
+		},
+	}
+
+	indexes := bulk.desiredIndexes()
+
+	var names []string
+	for _, index := range indexes {
+		names = append(names, index.collection+"."+indexName(index.index))
+	}
+
+	expected := "orders.customerId_1 orders_history.eventTime_1 orders.scd_versions"
+	if strings.Join(names, " ") != expected {
+		t.Errorf("Expected indexes %s, got %v", expected, names)
+	}
+}
+
+func Test_validateDocuments_should_apply_schema_policy(t *testing.T) {
+	inline := map[string]any{
+		"type":     "object",
+		"required": []any{"name"},
+		"properties": map[string]any{
+			"name":    map[string]any{"type": "string"},
+			"address": map[string]any{"type": "object", "properties": map[string]any{"zip": map[string]any{"type": "string"}}},
+		},
+	}
+	valid := &mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1", "name": "test"}, Operation: mongodb.Upsert}
+	invalid := &mongodb.Raw{ID: "doc2", Document: bson.M{"_id": "doc2", "address": bson.M{"zip": 34000}}, Operation: mongodb.Upsert}
+	deletion := &mongodb.Raw{ID: "doc3", Document: bson.M{"_id": "doc3"}, Operation: mongodb.Delete}
+
+	tests := []struct {
+		policy         string
+		expectedModels int
+		expectedFailed int
+		expectErr      bool
+	}{
+		{policy: config.SchemaPolicySkip, expectedModels: 2},
+		{policy: config.SchemaPolicyDeadLetter, expectedModels: 2, expectedFailed: 1},
+		{policy: config.SchemaPolicyFlag, expectedModels: 3},
+		{policy: config.SchemaPolicyHalt, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			bulk := createTestBulkWithoutConnection(t)
+			bulk.collectionOptions = map[string]config.CollectionOptions{
+				"testcollection": {Schema: config.SchemaOptions{Inline: inline, Policy: tt.policy, FlagField: "_schemaErrors"}},
+			}
+
+			var err error
+			if bulk.schemas, err = compileSchemas(bulk.collectionOptions); err != nil {
+				t.Fatalf("Expected schema to compile, got %v", err)
+			}
+
+			var failed int
+			bulk.hooks.OnDocumentFailed = func(ctx mongodb.DocumentFailedContext) { failed++ }
+
+			for _, model := range []*mongodb.Raw{valid, invalid, deletion} {
+				model.MongoCollection = "testcollection"
+			}
+
+			models, err := bulk.validateDocuments([]mongodb.Model{valid, invalid, deletion})
+
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("Expected error %v, got %v", tt.expectErr, err)
+			}
+
+			if len(models) != tt.expectedModels || failed != tt.expectedFailed {
+				t.Errorf("Expected %d models and %d failed, got %d and %d", tt.expectedModels, tt.expectedFailed, len(models), failed)
+			}
+
+			if tt.policy == config.SchemaPolicyFlag {
+				flagged := models[1].(*mongodb.Raw).Document["_schemaErrors"].(bson.A)
+				if len(flagged) != 2 {
+					t.Errorf("Expected the missing name and the zip type to be flagged, got %v", flagged)
+				}
+				if _, ok := invalid.Document["_schemaErrors"]; ok {
+					t.Errorf("Expected the mapped document not to be modified")
+				}
+			}
+		})
+	}
+}
+
+func Test_dryRun_should_send_write_models_to_sink_and_commit_only_when_enabled(t *testing.T) {
+	bulk := createTestBulkWithoutConnection(t)
+	recorder := NewRecorder()
+	bulk.sink = recorder
+
+	var commits int
+	bulk.dcpCheckpointCommit = func() { commits++ }
+
+	acked := false
+	bulk.AddActions(&models.ListenerContext{Ack: func() { acked = true }}, time.Now(), []mongodb.Model{
+		&mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1", "name": "test"}, Operation: mongodb.Upsert},
+		&mongodb.Raw{ID: "doc2", Document: bson.M{"_id": "doc2"}, Operation: mongodb.Delete},
+	}, "_default", 0)
+
+	if err := bulk.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	writes := recorder.Writes()
+	if len(writes) != 2 || writes[0].Collection != "testcollection" {
+		t.Fatalf("Expected 2 writes to testcollection, got %v", writes)
+	}
+	if replace, ok := writes[0].Model.(*mongo.ReplaceOneModel); !ok || replace.Upsert == nil || !*replace.Upsert {
+		t.Errorf("Expected an upserting replace model, got %T", writes[0].Model)
+	}
+	if _, ok := writes[1].Model.(*mongo.DeleteOneModel); !ok {
+		t.Errorf("Expected a delete model, got %T", writes[1].Model)
+	}
+	if !acked || commits != 0 {
+		t.Errorf("Expected the event acked without committing, acked: %v, commits: %d", acked, commits)
+	}
+
+	bulk.isDryRunCommitted = true
+	if err := bulk.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if commits != 1 {
+		t.Errorf("Expected a commit once dry run commits are enabled, got %d", commits)
+	}
+}
+
+func Test_NewBulk_should_dry_run_without_a_mongodb_client(t *testing.T) {
+	logger.InitDefaultLogger(logger.ERROR)
+
+	cfg := &config.Config{MongoDB: config.MongoDB{
+		Connection:        config.Connection{URI: "mongodb://unreachable.invalid:27017", Database: "test_db"},
+		CollectionMapping: map[string]string{"_default": "testcollection"},
+		CollectionOptions: map[string]config.CollectionOptions{"testcollection": {SCD: config.SCDOptions{Enabled: true}}},
+		Transaction:       config.Transaction{Scope: config.TransactionScopeBatch},
+	}}
+	cfg.ApplyDefaults()
+
+	recorder := NewRecorder()
+	bulk, err := NewBulk(cfg, func() {}, nil, mongodb.Hooks{}, recorder)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer func() { _ = bulk.Shutdown(context.Background()) }()
+
+	if bulk.client != nil || bulk.Ping(context.Background()) != nil {
+		t.Fatalf("Expected no mongodb client in dry run")
+	}
+
+	bulk.AddActions(&models.ListenerContext{Ack: func() {}}, time.Now(), []mongodb.Model{
+		&mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1"}, Operation: mongodb.Upsert},
+	}, "_default", 0)
+	if err := bulk.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	writes := recorder.Writes()
+	if len(writes) != 2 {
+		t.Fatalf("Expected the open and close of the version, got %v", writes)
+	}
+	if !writes[0].Unresolved || !writes[1].Unresolved {
+		t.Errorf("Expected the version writes to be unresolved, got %v", writes)
+	}
+}
+
+func Test_fileSink_should_append_writes_as_json_lines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "writes.jsonl")
+
+	for i := 0; i < 2; i++ {
+		sink, err := newFileSink(path)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		err = sink.Write(context.Background(), []Write{{
+			Time:       time.Now(),
+			Model:      mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": i}).SetUpdate(bson.M{"$set": bson.M{"name": "test"}}),
+			Collection: "users",
+		}})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+
+	var write struct {
+		Collection string `json:"collection"`
+		UpdateOne  struct {
+			Filter map[string]any `json:"filter"`
+			Upsert bool           `json:"upsert"`
+		} `json:"updateOne"`
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &write); err != nil {
+		t.Fatalf("Expected a JSON line, got %s: %v", lines[1], err)
+	}
+	if write.Collection != "users" || write.UpdateOne.Filter["_id"] != float64(1) || write.UpdateOne.Upsert {
+		t.Errorf("Expected the update of document 1 in users, got %s", lines[1])
+	}
+}
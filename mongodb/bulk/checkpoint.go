@@ -0,0 +1,169 @@
+package bulk
+
+import (
+	"sync"
+
+	"github.com/Trendyol/go-dcp/metadata"
+	"github.com/Trendyol/go-dcp/models"
+	"github.com/Trendyol/go-dcp/wrapper"
+)
+
+// checkpointOffsets holds per vbucket the offset go-dcp moved it to last, the offset of the written batches committed
+// by the bulk and the checkpoint saved in the metadata.
+type checkpointOffsets struct {
+	tracked   map[uint16]*models.Offset
+	committed map[uint16]*models.Offset
+	saved     map[uint16]*models.CheckpointDocument
+	lock      sync.Mutex
+}
+
+func newCheckpointOffsets() *checkpointOffsets {
+	return &checkpointOffsets{
+		tracked:   make(map[uint16]*models.Offset),
+		committed: make(map[uint16]*models.Offset),
+		saved:     make(map[uint16]*models.CheckpointDocument),
+	}
+}
+
+func (o *checkpointOffsets) track(vbID uint16, offset *models.Offset) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.tracked[vbID] = offset
+}
+
+func (o *checkpointOffsets) snapshot() map[uint16]*models.Offset {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	offsets := make(map[uint16]*models.Offset, len(o.tracked))
+	for vbID, offset := range o.tracked {
+		offsets[vbID] = offset
+	}
+	return offsets
+}
+
+// commit keeps the highest offset per vbucket, a commit finishing after a later one must not move the checkpoint back.
+func (o *checkpointOffsets) commit(offsets map[uint16]*models.Offset) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	for vbID, offset := range offsets {
+		if committed, ok := o.committed[vbID]; !ok || committed.SeqNo <= offset.SeqNo {
+			o.committed[vbID] = offset
+		}
+	}
+}
+
+// checkpoints replaces the offsets of state with the committed ones. Only vbuckets whose committed offset is not saved
+// yet are dirty, the others keep their saved checkpoint and vbuckets without either are left out.
+func (o *checkpointOffsets) checkpoints(
+	state map[uint16]*models.CheckpointDocument, bucketUUID string,
+) (map[uint16]*models.CheckpointDocument, map[uint16]bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	checkpoints := make(map[uint16]*models.CheckpointDocument, len(state))
+	dirtyOffsets := make(map[uint16]bool, len(state))
+
+	for vbID := range state {
+		saved, isSaved := o.saved[vbID]
+		offset, isCommitted := o.committed[vbID]
+
+		switch {
+		case isCommitted && !isSavedOffset(saved, offset):
+			checkpoints[vbID] = newCheckpointDocument(offset, bucketUUID)
+			dirtyOffsets[vbID] = true
+		case isSaved:
+			checkpoints[vbID] = saved
+			dirtyOffsets[vbID] = false
+		}
+	}
+
+	return checkpoints, dirtyOffsets
+}
+
+func (o *checkpointOffsets) markSaved(checkpoints map[uint16]*models.CheckpointDocument, dirtyOffsets map[uint16]bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	for vbID, dirty := range dirtyOffsets {
+		if dirty {
+			o.saved[vbID] = checkpoints[vbID]
+		}
+	}
+}
+
+// reset forgets the offsets of vbuckets whose streams are opened again, e.g. after a rebalance, and starts from the
+// checkpoints loaded for them.
+func (o *checkpointOffsets) reset(vbIDs []uint16, checkpoints *wrapper.ConcurrentSwissMap[uint16, *models.CheckpointDocument]) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	for _, vbID := range vbIDs {
+		delete(o.tracked, vbID)
+		delete(o.committed, vbID)
+		delete(o.saved, vbID)
+	}
+
+	checkpoints.Range(func(vbID uint16, checkpoint *models.CheckpointDocument) bool {
+		o.saved[vbID] = checkpoint
+		return true
+	})
+}
+
+func isSavedOffset(saved *models.CheckpointDocument, offset *models.Offset) bool {
+	return saved != nil && saved.Checkpoint != nil &&
+		saved.Checkpoint.SeqNo == offset.SeqNo && saved.Checkpoint.VbUUID == uint64(offset.VbUUID)
+}
+
+func newCheckpointDocument(offset *models.Offset, bucketUUID string) *models.CheckpointDocument {
+	return &models.CheckpointDocument{
+		Checkpoint: &models.CheckpointDocumentCheckpoint{
+			VbUUID: uint64(offset.VbUUID),
+			SeqNo:  offset.SeqNo,
+			Snapshot: &models.CheckpointDocumentSnapshot{
+				StartSeqNo: offset.StartSeqNo,
+				EndSeqNo:   offset.EndSeqNo,
+			},
+		},
+		BucketUUID: bucketUUID,
+	}
+}
+
+// TrackOffset records the offset go-dcp moved a vbucket to, for acked events as well as for events that never reach
+// the listener. The connector forwards it from its dcp consumer.
+func (b *Bulk) TrackOffset(vbID uint16, offset *models.Offset) {
+	b.offsets.track(vbID, offset)
+}
+
+// CheckpointMetadata wraps the metadata of go-dcp so it saves the offsets committed by the bulk instead of the offsets
+// go-dcp tracked last, which already cover the acked events of batches that are still being written.
+func (b *Bulk) CheckpointMetadata(dcpMetadata metadata.Metadata) metadata.Metadata {
+	return &checkpointMetadata{Metadata: dcpMetadata, offsets: b.offsets}
+}
+
+type checkpointMetadata struct {
+	metadata.Metadata
+	offsets *checkpointOffsets
+}
+
+func (m *checkpointMetadata) Save(state map[uint16]*models.CheckpointDocument, _ map[uint16]bool, bucketUUID string) error {
+	checkpoints, dirtyOffsets := m.offsets.checkpoints(state, bucketUUID)
+
+	if err := m.Metadata.Save(checkpoints, dirtyOffsets, bucketUUID); err != nil {
+		return err
+	}
+
+	m.offsets.markSaved(checkpoints, dirtyOffsets)
+	return nil
+}
+
+func (m *checkpointMetadata) Load(
+	vbIDs []uint16, bucketUUID string,
+) (*wrapper.ConcurrentSwissMap[uint16, *models.CheckpointDocument], bool, error) {
+	checkpoints, exist, err := m.Metadata.Load(vbIDs, bucketUUID)
+	if err == nil {
+		m.offsets.reset(vbIDs, checkpoints)
+	}
+	return checkpoints, exist, err
+}
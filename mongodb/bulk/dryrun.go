@@ -0,0 +1,195 @@
+package bulk
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	config "github.com/Trendyol/go-dcp-mongodb/configs"
+	"github.com/Trendyol/go-dcp-mongodb/mongodb"
+	"github.com/Trendyol/go-dcp/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Write is a write model the bulk would have sent to a collection. Unresolved writes depend on documents in MongoDB
+// that a dry run without a client could not read, e.g. SCD versions and history diffs.
+type Write struct {
+	Time       time.Time
+	Model      mongo.WriteModel
+	Collection string
+	Unresolved bool
+}
+
+// WriteSink receives the writes of a batch in dry run instead of MongoDB, in the order of the batch. Writes of
+// different partitions are sent concurrently. A sink implementing io.Closer is closed on Shutdown.
+type WriteSink interface {
+	Write(ctx context.Context, writes []Write) error
+}
+
+// Recorder keeps the writes in memory, e.g. to test a mapper against recorded traffic.
+type Recorder struct {
+	writes []Write
+	lock   sync.Mutex
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Write(_ context.Context, writes []Write) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.writes = append(r.writes, writes...)
+	return nil
+}
+
+// Writes returns the writes recorded so far.
+func (r *Recorder) Writes() []Write {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]Write(nil), r.writes...)
+}
+
+type logSink struct{}
+
+func (logSink) Write(_ context.Context, writes []Write) error {
+	for _, write := range writes {
+		line, err := marshalWrite(write)
+		if err != nil {
+			return err
+		}
+		logger.Log.Info("dry run write: %s", line)
+	}
+	return nil
+}
+
+// fileSink appends the writes to a file as JSON lines.
+type fileSink struct {
+	file *os.File
+	lock sync.Mutex
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening dry run file: %w", err)
+	}
+	return &fileSink{file: file}, nil
+}
+
+func (s *fileSink) Write(_ context.Context, writes []Write) error {
+	var lines []byte
+	for _, write := range writes {
+		line, err := marshalWrite(write)
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err := s.file.Write(lines); err != nil {
+		return fmt.Errorf("error while writing dry run file: %w", err)
+	}
+	return nil
+}
+
+func (s *fileSink) Close() error {
+	return s.file.Close()
+}
+
+func newWriteSink(dryRun config.DryRun) (WriteSink, error) {
+	if dryRun.Sink == config.DryRunSinkFile {
+		return newFileSink(dryRun.File)
+	}
+	return logSink{}, nil
+}
+
+// dryRunRequest builds the write models of the batch like a bulk request would and sends them to the sink.
+func (b *Bulk) dryRunRequest(ctx context.Context, batch []BatchItem) error {
+	now := time.Now()
+
+	writes := make([]Write, 0, len(batch))
+	for _, item := range batch {
+		if collection, ok := collectionOf(item.Model); ok {
+			writes = append(writes, Write{
+				Time:       now,
+				Model:      b.buildWriteModel(item),
+				Collection: collection,
+				Unresolved: b.database == nil && readsDocuments(item.Model),
+			})
+		}
+	}
+
+	if err := b.sink.Write(ctx, writes); err != nil {
+		return fmt.Errorf("dry run sink error: %w", err)
+	}
+	return nil
+}
+
+// readsDocuments reports whether the model depends on documents in MongoDB, SCD versions are numbered after the
+// latest written one and history diffs are taken against the current document.
+func readsDocuments(model mongodb.Model) bool {
+	switch m := model.(type) {
+	case *versionModel:
+		return true
+	case *historyRecord:
+		return m.diff
+	default:
+		return false
+	}
+}
+
+// marshalWrite encodes a write as relaxed extended JSON in the shape of the mongosh bulkWrite operations,
+// e.g. {"collection": "users", "replaceOne": {"filter": ..., "replacement": ..., "upsert": true}}.
+func marshalWrite(write Write) ([]byte, error) {
+	var operation bson.E
+	switch model := write.Model.(type) {
+	case *mongo.InsertOneModel:
+		operation = bson.E{Key: "insertOne", Value: bson.D{{Key: "document", Value: model.Document}}}
+	case *mongo.ReplaceOneModel:
+		operation = bson.E{Key: "replaceOne", Value: bson.D{
+			{Key: "filter", Value: model.Filter},
+			{Key: "replacement", Value: model.Replacement},
+			{Key: "upsert", Value: model.Upsert != nil && *model.Upsert},
+		}}
+	case *mongo.UpdateOneModel:
+		operation = bson.E{Key: "updateOne", Value: updateDocument(model.Filter, model.Update, model.Upsert, model.ArrayFilters)}
+	case *mongo.UpdateManyModel:
+		operation = bson.E{Key: "updateMany", Value: updateDocument(model.Filter, model.Update, model.Upsert, model.ArrayFilters)}
+	case *mongo.DeleteOneModel:
+		operation = bson.E{Key: "deleteOne", Value: bson.D{{Key: "filter", Value: model.Filter}}}
+	case *mongo.DeleteManyModel:
+		operation = bson.E{Key: "deleteMany", Value: bson.D{{Key: "filter", Value: model.Filter}}}
+	default:
+		return nil, fmt.Errorf("unsupported write model %T", write.Model)
+	}
+
+	document := bson.D{{Key: "time", Value: write.Time}, {Key: "collection", Value: write.Collection}, operation}
+	if write.Unresolved {
+		document = append(document, bson.E{Key: "unresolved", Value: true})
+	}
+	line, err := bson.MarshalExtJSON(document, false, false)
+	if err != nil {
+		return nil, fmt.Errorf("error while encoding dry run write to %s: %w", write.Collection, err)
+	}
+	return line, nil
+}
+
+func updateDocument(filter, update any, upsert *bool, arrayFilters *options.ArrayFilters) bson.D {
+	document := bson.D{
+		{Key: "filter", Value: filter},
+		{Key: "update", Value: update},
+		{Key: "upsert", Value: upsert != nil && *upsert},
+	}
+	if arrayFilters != nil {
+		document = append(document, bson.E{Key: "arrayFilters", Value: arrayFilters.Filters})
+	}
+	return document
+}
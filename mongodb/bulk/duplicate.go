@@ -0,0 +1,83 @@
+package bulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	config "github.com/Trendyol/go-dcp-mongodb/configs"
+	"github.com/Trendyol/go-dcp-mongodb/mongodb"
+	"github.com/Trendyol/go-dcp/logger"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const duplicateKeyErrorCode = 11000
+
+// handleWriteErrors passes rejected documents to OnDocumentFailed and applies the duplicate key policy of the
+// collection to duplicate key errors. Documents of the overwrite policy are written again as replacements.
+func (b *Bulk) handleWriteErrors(
+	ctx context.Context, collectionName string, items []BatchItem, writeErrors []mongo.BulkWriteError,
+) error {
+	var overwrites []BatchItem
+	var errs []error
+
+	for _, writeErr := range writeErrors {
+		item := items[writeErr.Index]
+
+		if writeErr.Code != duplicateKeyErrorCode {
+			b.documentFailed(collectionName, item, writeErr)
+			continue
+		}
+
+		policy := b.duplicateKeyPolicy(collectionName)
+		b.metricsRecorder.RecordDuplicateKey(collectionName, policy)
+
+		switch policy {
+		case config.DuplicateKeyPolicyIgnore:
+			logger.Log.Debug("ignoring duplicate key error of collection %s: %v", collectionName, writeErr)
+		case config.DuplicateKeyPolicyOverwrite:
+			if _, ok := item.Model.(*mongodb.Raw); ok {
+				overwrites = append(overwrites, item)
+			} else {
+				b.documentFailed(collectionName, item, writeErr)
+			}
+		case config.DuplicateKeyPolicyFail:
+			errs = append(errs, fmt.Errorf("duplicate key error for collection %s: %v", collectionName, writeErr))
+		default:
+			logger.Log.Error("duplicate key error of collection %s: %v", collectionName, writeErr)
+			b.documentFailed(collectionName, item, writeErr)
+		}
+	}
+
+	if len(overwrites) > 0 {
+		errs = append(errs, b.overwrite(ctx, collectionName, overwrites))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (b *Bulk) duplicateKeyPolicy(collectionName string) string {
+	if policy := b.collectionOptions[collectionName].DuplicateKeyPolicy; policy != "" {
+		return policy
+	}
+	return config.DuplicateKeyPolicyDeadLetter
+}
+
+// overwrite replaces the existing documents with the documents that failed to insert.
+func (b *Bulk) overwrite(ctx context.Context, collectionName string, items []BatchItem) error {
+	writeModels := make([]mongo.WriteModel, 0, len(items))
+	for _, item := range items {
+		writeModels = append(writeModels, b.buildReplaceModel(item.Model.(*mongodb.Raw), item.Bytes))
+	}
+
+	writeErrors, err := b.executeWriteModels(ctx, collectionName, writeModels, false)
+	if err != nil {
+		return err
+	}
+
+	for _, writeErr := range writeErrors {
+		b.documentFailed(collectionName, items[writeErr.Index], writeErr)
+	}
+
+	return nil
+}
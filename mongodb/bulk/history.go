@@ -0,0 +1,204 @@
+package bulk
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	config "github.com/Trendyol/go-dcp-mongodb/configs"
+	"github.com/Trendyol/go-dcp-mongodb/mongodb"
+	"github.com/Trendyol/go-dcp/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// historyRecord is the history entry of a model, inserted into the history collection of its collection.
+type historyRecord struct {
+	eventTime  time.Time
+	documentID any
+	document   bson.M
+	// changes is resolved right before the record is written when the collection records diffs
+	changes    bson.M
+	collection string
+	history    string
+	key        string
+	operation  mongodb.OperationType
+	event      string
+	cas        uint64
+	seqNo      uint64
+	vbID       uint16
+	diff       bool
+}
+
+func (r *historyRecord) Convert() *mongodb.ExecArgs {
+	return &mongodb.ExecArgs{
+		Document:  r.document,
+		Operation: mongodb.Insert,
+	}
+}
+
+func (r *historyRecord) toDocument() bson.D {
+	record := bson.D{
+		{Key: "key", Value: r.key},
+		{Key: "documentId", Value: r.documentID},
+		{Key: "operation", Value: r.operation},
+		{Key: "event", Value: r.event},
+		{Key: "cas", Value: int64(r.cas)},
+		{Key: "seqNo", Value: int64(r.seqNo)},
+		{Key: "vbId", Value: int32(r.vbID)},
+		{Key: "eventTime", Value: r.eventTime},
+	}
+
+	if r.diff {
+		return append(record, bson.E{Key: "changes", Value: r.changes})
+	}
+
+	return append(record, bson.E{Key: "document", Value: r.document})
+}
+
+func (b *Bulk) historyCollection(collection string) string {
+	if history := b.collectionOptions[collection].History.Collection; history != "" {
+		return history
+	}
+	return collection + "_history"
+}
+
+// withHistory adds a history record after every model of a collection with history enabled, the model itself is
+// dropped when the collection only keeps history.
+func (b *Bulk) withHistory(ctx *models.ListenerContext, eventTime time.Time, actions []mongodb.Model) []mongodb.Model {
+	if len(b.collectionOptions) == 0 {
+		return actions
+	}
+
+	result := make([]mongodb.Model, 0, len(actions))
+	for _, action := range actions {
+		rawModel, ok := action.(*mongodb.Raw)
+		if !ok || !b.collectionOptions[rawModel.MongoCollection].History.Enabled {
+			result = append(result, action)
+			continue
+		}
+
+		if !b.collectionOptions[rawModel.MongoCollection].History.Only {
+			result = append(result, action)
+		}
+		result = append(result, b.newHistoryRecord(ctx, eventTime, rawModel))
+	}
+
+	return result
+}
+
+// newHistoryRecord builds the history record of a model from the DCP event it was mapped from.
+func (b *Bulk) newHistoryRecord(ctx *models.ListenerContext, eventTime time.Time, rawModel *mongodb.Raw) *historyRecord {
+	record := &historyRecord{
+		eventTime:  eventTime,
+		documentID: rawModel.Document["_id"],
+		collection: rawModel.MongoCollection,
+		history:    b.historyCollection(rawModel.MongoCollection),
+		operation:  rawModel.Operation,
+		diff:       b.collectionOptions[rawModel.MongoCollection].History.Document == config.HistoryDocumentDiff,
+	}
+
+	if record.documentID == nil {
+		record.documentID = rawModel.ID
+	}
+
+	if rawModel.Operation != mongodb.Delete {
+		record.document = rawModel.Document
+	}
+
+	switch event := ctx.Event.(type) {
+	case models.DcpMutation:
+		record.event, record.key, record.cas, record.seqNo, record.vbID = "mutation", string(event.Key), event.Cas, event.SeqNo, event.VbID
+	case models.DcpDeletion:
+		record.event, record.key, record.cas, record.seqNo, record.vbID = "deletion", string(event.Key), event.Cas, event.SeqNo, event.VbID
+	case models.DcpExpiration:
+		record.event, record.key, record.cas, record.seqNo, record.vbID = "expiration", string(event.Key), event.Cas, event.SeqNo, event.VbID
+	}
+
+	return record
+}
+
+// resolveHistoryChanges computes the changes of diff records against the current documents, so it must run before
+// the batch is written. Records of the same document within the batch are diffed against each other in order.
+// A dry run without a client diffs the first record of a document against nothing, its writes are marked unresolved.
+func (b *Bulk) resolveHistoryChanges(ctx context.Context, items []BatchItem) error {
+	recordsByCollection := make(map[string][]*historyRecord)
+	for _, item := range items {
+		if record, ok := item.Model.(*historyRecord); ok && record.diff {
+			recordsByCollection[record.collection] = append(recordsByCollection[record.collection], record)
+		}
+	}
+
+	for collection, records := range recordsByCollection {
+		ids := make([]any, 0, len(records))
+		for _, record := range records {
+			ids = append(ids, record.documentID)
+		}
+
+		current := make(map[string]bson.M)
+		if b.database != nil {
+			var err error
+			if current, err = b.findDocuments(ctx, collection, ids); err != nil {
+				return fmt.Errorf("error while reading current documents of %s for history: %w", collection, err)
+			}
+		}
+
+		for _, record := range records {
+			id := fmt.Sprint(record.documentID)
+			record.changes = diffDocuments(current[id], record.document)
+			current[id] = record.document
+		}
+	}
+
+	return nil
+}
+
+func (b *Bulk) findDocuments(ctx context.Context, collection string, ids []any) (map[string]bson.M, error) {
+	cursor, err := b.database.Collection(collection).Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []bson.M
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]bson.M, len(documents))
+	for _, document := range documents {
+		current[fmt.Sprint(document["_id"])] = document
+	}
+
+	return current, nil
+}
+
+// diffDocuments returns the flattened paths set or changed by document and the paths it removed from previous.
+func diffDocuments(previous bson.M, document bson.M) bson.M {
+	previousFields, fields := flattenDocument(previous), flattenDocument(document)
+
+	set := bson.M{}
+	for path, value := range fields {
+		if previousValue, ok := previousFields[path]; !ok || !reflect.DeepEqual(previousValue, value) {
+			set[path] = value
+		}
+	}
+
+	unset := bson.A{}
+	for path := range previousFields {
+		if _, ok := fields[path]; !ok {
+			unset = append(unset, path)
+		}
+	}
+
+	return bson.M{"set": set, "unset": unset}
+}
+
+func flattenDocument(document bson.M) bson.M {
+	fields, unset, addToSet := bson.M{}, bson.M{}, bson.M{}
+	for key, value := range document {
+		if key != "_id" {
+			flatten(key, value, config.MergeOptions{}, fields, unset, addToSet)
+		}
+	}
+	return fields
+}
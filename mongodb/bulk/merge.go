@@ -0,0 +1,200 @@
+package bulk
+
+import (
+	config "github.com/Trendyol/go-dcp-mongodb/configs"
+	"github.com/Trendyol/go-dcp-mongodb/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// isMerge reports whether the model deep-merges into the existing document, either explicitly or by the
+// merge default of its collection.
+func (b *Bulk) isMerge(rawModel *mongodb.Raw) bool {
+	switch rawModel.Operation {
+	case mongodb.Merge:
+		return true
+	case mongodb.Update, mongodb.Upsert:
+		return b.collectionOptions[rawModel.MongoCollection].Merge.Default
+	default:
+		return false
+	}
+}
+
+func (b *Bulk) buildMergeModel(rawModel *mongodb.Raw) *mongo.UpdateOneModel {
+	update := buildMergeUpdate(rawModel.Document, b.collectionOptions[rawModel.MongoCollection].Merge)
+
+	return mongo.NewUpdateOneModel().
+		SetFilter(b.buildFilter(rawModel.Document)).
+		SetUpdate(update).
+		SetUpsert(true)
+}
+
+// buildMergeUpdate sets every leaf of the document on its flattened path, so fields of the existing document
+// that are not in the incoming one are kept.
+func buildMergeUpdate(document bson.M, options config.MergeOptions) bson.M {
+	set, unset, addToSet := bson.M{}, bson.M{}, bson.M{}
+
+	for key, value := range document {
+		if key == "_id" {
+			continue
+		}
+		flatten(key, value, options, set, unset, addToSet)
+	}
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	if len(addToSet) > 0 {
+		update["$addToSet"] = addToSet
+	}
+
+	// an update needs at least one operator, setting _id to itself upserts an empty document
+	if len(update) == 0 {
+		update["$set"] = bson.M{"_id": document["_id"]}
+	}
+
+	return update
+}
+
+func flatten(path string, value any, options config.MergeOptions, set, unset, addToSet bson.M) {
+	if value == nil && options.NullFields == config.MergeNullFieldsUnset {
+		unset[path] = ""
+		return
+	}
+
+	if fields, ok := asDocument(value); ok && len(fields) > 0 {
+		for key, fieldValue := range fields {
+			flatten(path+"."+key, fieldValue, options, set, unset, addToSet)
+		}
+		return
+	}
+
+	if values, ok := asArray(value); ok && options.Arrays == config.MergeArraysAddToSet {
+		addToSet[path] = bson.M{"$each": values}
+		return
+	}
+
+	set[path] = value
+}
+
+// mergeDocuments deep-merges document into base the way applying both merges in sequence would.
+func mergeDocuments(base bson.M, document bson.M, options config.MergeOptions) bson.M {
+	merged := make(bson.M, len(base)+len(document))
+	for key, value := range base {
+		merged[key] = value
+	}
+
+	for key, value := range document {
+		baseValue, exists := merged[key]
+		if !exists {
+			merged[key] = value
+			continue
+		}
+
+		baseFields, baseIsDocument := asDocument(baseValue)
+		fields, isDocument := asDocument(value)
+		if baseIsDocument && isDocument && len(fields) > 0 {
+			merged[key] = mergeDocuments(baseFields, fields, options)
+			continue
+		}
+
+		baseValues, baseIsArray := asArray(baseValue)
+		values, isArray := asArray(value)
+		if baseIsArray && isArray && options.Arrays == config.MergeArraysAddToSet {
+			merged[key] = append(append(bson.A{}, baseValues...), values...)
+			continue
+		}
+
+		merged[key] = value
+	}
+
+	return merged
+}
+
+func asDocument(value any) (bson.M, bool) {
+	switch v := value.(type) {
+	case bson.M:
+		return v, true
+	case map[string]any:
+		return v, true
+	case bson.D:
+		fields := make(bson.M, len(v))
+		for _, field := range v {
+			fields[field.Key] = field.Value
+		}
+		return fields, true
+	default:
+		return nil, false
+	}
+}
+
+func asArray(value any) (bson.A, bool) {
+	switch v := value.(type) {
+	case bson.A:
+		return v, true
+	case []any:
+		return v, true
+	default:
+		return nil, false
+	}
+}
+
+// mergeItems combines a merge with the earlier item of the same document buffered in one batch, so the item
+// written has the effect of both. A merge into a replaced or deleted document becomes a replacement, the merge
+// alone would keep the fields the replacement or the delete removed.
+func (b *Bulk) mergeItems(previous BatchItem, item BatchItem) (BatchItem, bool) {
+	previousModel, ok := previous.Model.(*mongodb.Raw)
+	if !ok {
+		return item, false
+	}
+
+	rawModel, ok := item.Model.(*mongodb.Raw)
+	if !ok || item.Replace || !b.isMerge(rawModel) {
+		return item, false
+	}
+
+	options := b.collectionOptions[rawModel.MongoCollection].Merge
+
+	merged := *rawModel
+	replace := false
+	switch {
+	case previousModel.Operation == mongodb.Delete:
+		merged.Operation, replace = mongodb.Upsert, true
+		merged.Document = withoutNullFields(rawModel.Document, options)
+	case previous.Replace || !b.isMerge(previousModel):
+		merged.Operation, replace = previousModel.Operation, true
+		merged.Document = withoutNullFields(mergeDocuments(previousModel.Document, rawModel.Document, options), options)
+	default:
+		merged.Document = mergeDocuments(previousModel.Document, rawModel.Document, options)
+	}
+
+	bytes, err := bson.Marshal(merged.Document)
+	if err != nil {
+		return item, false
+	}
+
+	return BatchItem{Model: &merged, Bytes: bytes, Size: len(bytes), Event: item.Event, Replace: replace}, true
+}
+
+// withoutNullFields removes the fields a merge would unset from a document that replaces the existing one.
+func withoutNullFields(document bson.M, options config.MergeOptions) bson.M {
+	if options.NullFields != config.MergeNullFieldsUnset {
+		return document
+	}
+
+	result := make(bson.M, len(document))
+	for key, value := range document {
+		if value == nil {
+			continue
+		}
+		if fields, ok := asDocument(value); ok {
+			value = withoutNullFields(fields, options)
+		}
+		result[key] = value
+	}
+	return result
+}
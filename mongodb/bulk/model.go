@@ -0,0 +1,49 @@
+package bulk
+
+import "github.com/Trendyol/go-dcp-mongodb/mongodb"
+
+// collectionOf returns the MongoDB collection the model is written to.
+func collectionOf(model mongodb.Model) (string, bool) {
+	switch m := model.(type) {
+	case *mongodb.Raw:
+		return m.MongoCollection, true
+	case *mongodb.DeleteMany:
+		return m.MongoCollection, true
+	case *mongodb.UpdateMany:
+		return m.MongoCollection, true
+	case *mongodb.PipelineUpdate:
+		return m.MongoCollection, true
+	case *historyRecord:
+		return m.history, true
+	case *versionModel:
+		return m.change.collection, true
+	case *measurement:
+		return m.collection, true
+	default:
+		return "", false
+	}
+}
+
+func setCollection(model mongodb.Model, collection string) {
+	switch m := model.(type) {
+	case *mongodb.Raw:
+		m.MongoCollection = collection
+	case *mongodb.DeleteMany:
+		m.MongoCollection = collection
+	case *mongodb.UpdateMany:
+		m.MongoCollection = collection
+	case *mongodb.PipelineUpdate:
+		m.MongoCollection = collection
+	}
+}
+
+// isFilterModel reports whether the model writes the documents matching a filter or depends on the current document,
+// so writes of the same documents must not be moved across it.
+func isFilterModel(model mongodb.Model) bool {
+	switch model.(type) {
+	case *mongodb.DeleteMany, *mongodb.UpdateMany, *mongodb.PipelineUpdate:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,148 @@
+package bulk
+
+import (
+	"context"
+	"time"
+
+	"github.com/Trendyol/go-dcp-mongodb/mongodb"
+	"github.com/Trendyol/go-dcp/logger"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// isOrdered reports whether the collection is written with ordered bulk writes, SCD collections always are so the
+// pair of writes of a version change is applied in order.
+func (b *Bulk) isOrdered(collectionName string) bool {
+	collectionOptions := b.collectionOptions[collectionName]
+	return collectionOptions.Ordered || collectionOptions.SCD.Enabled
+}
+
+// sequentialRequest writes a batch holding filter based models in the order of the batch on a single goroutine, with an
+// ordered bulk write per run of consecutive items of a collection. A filter based model may match documents written
+// before or after it in the batch, concurrent or unordered writes could apply them on the wrong side of it.
+func (b *Bulk) sequentialRequest(ctx context.Context, batch []BatchItem) error {
+	for _, run := range collectionRuns(batch) {
+		collectionName, _ := collectionOf(run[0].Model)
+
+		for _, messageItems := range splitByMessageSize(run, MaxMessageByteSize-messageOverhead) {
+			bulkWriteCtx, cancel := context.WithTimeout(ctx, b.bulkRequestTimeout)
+			err := b.orderedBulkWrite(bulkWriteCtx, collectionName, messageItems)
+			cancel()
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// collectionRuns splits the batch into runs of consecutive items of the same collection, keeping their order.
+func collectionRuns(batch []BatchItem) [][]BatchItem {
+	var runs [][]BatchItem
+
+	start := 0
+	for i := 1; i <= len(batch); i++ {
+		if i == len(batch) || !isSameCollection(batch[i-1].Model, batch[i].Model) {
+			runs = append(runs, batch[start:i])
+			start = i
+		}
+	}
+
+	return runs
+}
+
+func isSameCollection(model, other mongodb.Model) bool {
+	collection, _ := collectionOf(model)
+	otherCollection, _ := collectionOf(other)
+	return collection == otherCollection
+}
+
+// orderedBulkWrite applies the items of an ordered collection in sequence. MongoDB stops an ordered bulk write at the
+// first failing document after applying every item before it, so the failed item is retried on its own up to
+// maxRetries times, passed to OnDocumentFailed when it still fails, and writing continues with the items after it.
+// Duplicate key errors are not retried, the duplicate key policy of the collection applies to them.
+// When a new version of an SCD collection cannot be opened, the close of the versions before it is skipped.
+func (b *Bulk) orderedBulkWrite(ctx context.Context, collectionName string, items []BatchItem) error {
+	for len(items) > 0 {
+		writeErrors, err := b.executeBulkWrite(ctx, collectionName, items, true)
+		if err != nil {
+			return err
+		}
+
+		if len(writeErrors) == 0 {
+			return nil
+		}
+
+		failedIndex := writeErrors[0].Index
+		applied, err := b.retryItem(ctx, collectionName, items[failedIndex], writeErrors[0])
+		if err != nil {
+			return err
+		}
+
+		next := failedIndex + 1
+		if model, ok := items[failedIndex].Model.(*versionModel); ok && !applied && next < len(items) && model.closes(items[next].Model) {
+			logger.Log.Warn("keeping the current version of document %v of collection %s open", model.change.documentID, collectionName)
+			next++
+		}
+
+		items = items[next:]
+	}
+
+	return nil
+}
+
+// retryBackoff is the wait before the first retry of a failed document, it doubles with every further retry up to
+// maxRetryBackoff.
+const (
+	retryBackoff    = 100 * time.Millisecond
+	maxRetryBackoff = 5 * time.Second
+)
+
+// retryItem reports whether the item was applied by a retry. The retries back off exponentially and stop with an
+// error when the context is done.
+func (b *Bulk) retryItem(ctx context.Context, collectionName string, item BatchItem, writeErr mongo.BulkWriteError) (bool, error) {
+	maxRetries := b.collectionOptions[collectionName].MaxRetries
+
+	for attempt := 1; attempt <= maxRetries && writeErr.Code != duplicateKeyErrorCode; attempt++ {
+		logger.Log.Warn("retrying failed document of collection %s, attempt %d/%d: %v", collectionName, attempt, maxRetries, writeErr)
+
+		if err := waitRetry(ctx, attempt); err != nil {
+			return false, err
+		}
+
+		writeErrors, err := b.executeBulkWrite(ctx, collectionName, []BatchItem{item}, true)
+		if err != nil {
+			return false, err
+		}
+
+		if len(writeErrors) == 0 {
+			return true, nil
+		}
+
+		writeErr = writeErrors[0]
+	}
+
+	writeErr.Index = 0
+	return false, b.handleWriteErrors(ctx, collectionName, []BatchItem{item}, []mongo.BulkWriteError{writeErr})
+}
+
+func waitRetry(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(retryDelay(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func retryDelay(attempt int) time.Duration {
+	delay := retryBackoff
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryBackoff)
+}
@@ -0,0 +1,120 @@
+package bulk
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Trendyol/go-dcp-mongodb/mongodb"
+)
+
+// partition owns the batch, flush ticker and writer of the vbuckets routed to it. Events of a vbucket
+// always land in the same partition, so they are written in order while partitions write to MongoDB
+// independently of each other.
+type partition struct {
+	bulk            *Bulk
+	batchTicker     *time.Ticker
+	batch           []BatchItem
+	batchKeys       map[string]int
+	flushCh         chan *pendingBatch
+	slots           chan struct{}
+	writerDone      chan struct{}
+	writeErr        error
+	id              int
+	batchIndex      int
+	batchEvents     int
+	batchSize       int
+	batchByteSize   int
+	inFlightBatches atomic.Int32
+	handoffLock     sync.Mutex
+	flushLock       sync.Mutex
+	isClosed        bool
+}
+
+func newPartition(b *Bulk, id int, maxInFlightBatches int) *partition {
+	return &partition{
+		bulk:        b,
+		id:          id,
+		batchTicker: time.NewTicker(b.batchTickerDuration),
+		batch:       make([]BatchItem, 0, b.sizeLimit()),
+		batchKeys:   make(map[string]int, b.sizeLimit()),
+		flushCh:     make(chan *pendingBatch, maxInFlightBatches),
+		slots:       make(chan struct{}, maxInFlightBatches),
+		writerDone:  make(chan struct{}),
+	}
+}
+
+// add puts the item into the batch, replacing the buffered item of the same document. Must be called with flushLock held.
+func (p *partition) add(item BatchItem) {
+	key := p.getActionKey(item.Model)
+
+	if batchIndex, ok := p.batchKeys[key]; ok {
+		// merges of different sources into the same document must all apply, so they are combined instead
+		if merged, ok := p.bulk.mergeItems(p.batch[batchIndex], item); ok {
+			item = merged
+		}
+		p.batchByteSize += item.Size - p.batch[batchIndex].Size
+		p.batch[batchIndex] = item
+		return
+	}
+
+	p.batch = append(p.batch, item)
+	p.batchKeys[key] = p.batchIndex
+	p.batchIndex++
+	p.batchSize++
+	p.batchByteSize += item.Size
+
+	// a later write replacing a buffered one would move ahead of the filter model, deduplication starts over after it
+	if isFilterModel(item.Model) {
+		clear(p.batchKeys)
+	}
+}
+
+func (p *partition) isFull() bool {
+	return p.batchSize >= p.bulk.sizeLimit() || p.batchByteSize >= p.bulk.batchByteSizeLimit
+}
+
+// getActionKey identifies the document a model writes, so a later model of the same document replaces it in the batch.
+// Filter based models such as DeleteMany and UpdateMany affect an unknown set of documents and PipelineUpdate depends
+// on the current document, so they always get a unique key and every one of them is written. Writes after them are
+// not deduplicated with writes before them, see add.
+func (p *partition) getActionKey(model mongodb.Model) string {
+	if rawModel, ok := model.(*mongodb.Raw); ok {
+		mongoCollection := rawModel.MongoCollection
+
+		if rawModel.ID != "" {
+			return fmt.Sprintf("%s:%s", mongoCollection, rawModel.ID)
+		}
+
+		if id, ok := rawModel.Document["_id"]; ok {
+			return fmt.Sprintf("%s:%v", mongoCollection, id)
+		}
+	}
+
+	return fmt.Sprintf("batch:%d", p.batchIndex)
+}
+
+func (p *partition) resetBatch() {
+	p.batchTicker.Reset(p.bulk.batchTickerDuration)
+
+	p.batch = make([]BatchItem, 0, p.bulk.sizeLimit())
+	p.batchKeys = make(map[string]int, p.bulk.sizeLimit())
+	p.batchEvents = 0
+	p.batchIndex = 0
+	p.batchSize = 0
+	p.batchByteSize = 0
+}
+
+func (p *partition) runTicker(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-p.batchTicker.C:
+			if _, err := p.handoff(p.bulk.writeCtx); err != nil {
+				p.bulk.reportError(err)
+			}
+		}
+	}
+}
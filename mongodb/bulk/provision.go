@@ -0,0 +1,456 @@
+package bulk
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	config "github.com/Trendyol/go-dcp-mongodb/configs"
+	"github.com/Trendyol/go-dcp/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ProvisionCreateCollection = "createCollection"
+	ProvisionUpdateValidator  = "updateValidator"
+	ProvisionCreateIndex      = "createIndex"
+	ProvisionUpdateIndexTTL   = "updateIndexTTL"
+	// ProvisionConflict is a difference that cannot be applied without dropping the collection or the index,
+	// it is only reported.
+	ProvisionConflict = "conflict"
+)
+
+// ProvisionChange is a difference between the configured and the existing collections and indexes.
+type ProvisionChange struct {
+	apply      func(ctx context.Context) error
+	Collection string `json:"collection"`
+	Action     string `json:"action"`
+	Detail     string `json:"detail"`
+	Applied    bool   `json:"applied"`
+}
+
+type collectionIndex struct {
+	collection string
+	index      config.IndexOptions
+}
+
+type existingIndex struct {
+	Collation               *config.Collation `bson:"collation"`
+	ExpireAfterSeconds      *int64            `bson:"expireAfterSeconds"`
+	PartialFilterExpression bson.Raw          `bson:"partialFilterExpression"`
+	Name                    string            `bson:"name"`
+	Key                     bson.D            `bson:"key"`
+	Unique                  bool              `bson:"unique"`
+}
+
+// provision ensures the collections and indexes of the collection options exist as configured. Only missing
+// collections and indexes are created, differences that cannot be applied in place are reported as conflicts.
+// With a dry run nothing is changed and the differences are only reported.
+func (b *Bulk) provision(ctx context.Context) error {
+	if b.provisioning.Disabled {
+		return nil
+	}
+
+	changes, err := b.provisionPlan(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range changes {
+		change := &changes[i]
+
+		if change.apply == nil {
+			logger.Log.Warn("provisioning %s of %s: %s", change.Action, change.Collection, change.Detail)
+			continue
+		}
+
+		if b.provisioning.DryRun {
+			logger.Log.Info("provisioning dry run, %s of %s: %s", change.Action, change.Collection, change.Detail)
+			continue
+		}
+
+		if err := change.apply(ctx); err != nil {
+			return fmt.Errorf("error while provisioning %s of %s: %w", change.Action, change.Collection, err)
+		}
+		change.Applied = true
+
+		logger.Log.Info("provisioned %s of %s: %s", change.Action, change.Collection, change.Detail)
+	}
+
+	b.provisionChanges = changes
+	return nil
+}
+
+func (b *Bulk) provisionPlan(ctx context.Context) ([]ProvisionChange, error) {
+	indexes := b.desiredIndexes()
+	if len(indexes) == 0 && !b.hasCreateOptions() {
+		return nil, nil
+	}
+
+	specifications, err := b.database.ListCollectionSpecifications(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("error while listing collections: %w", err)
+	}
+
+	existing := make(map[string]*mongo.CollectionSpecification, len(specifications))
+	for _, specification := range specifications {
+		existing[specification.Name] = specification
+	}
+
+	changes := b.planCollections(existing)
+
+	for _, index := range indexes {
+		change, err := b.planIndex(ctx, index, existing[index.collection] != nil)
+		if err != nil {
+			return nil, err
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+
+	return changes, nil
+}
+
+func (b *Bulk) hasCreateOptions() bool {
+	for _, collectionOptions := range b.collectionOptions {
+		if collectionOptions.TimeSeries.Enabled || !reflect.DeepEqual(collectionOptions.Create, config.CreateOptions{}) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Bulk) planCollections(existing map[string]*mongo.CollectionSpecification) []ProvisionChange {
+	var changes []ProvisionChange
+
+	for _, collection := range b.sortedCollections() {
+		collectionOptions := b.collectionOptions[collection]
+		create, timeSeries := collectionOptions.Create, collectionOptions.TimeSeries
+		if !timeSeries.Enabled && reflect.DeepEqual(create, config.CreateOptions{}) {
+			continue
+		}
+
+		specification, ok := existing[collection]
+		if !ok {
+			createOptions := createCollectionOptions(collectionOptions)
+			changes = append(changes, ProvisionChange{
+				Collection: collection,
+				Action:     ProvisionCreateCollection,
+				Detail:     describeCreateOptions(collectionOptions),
+				apply: func(ctx context.Context) error {
+					return b.database.CreateCollection(ctx, collection, createOptions)
+				},
+			})
+			continue
+		}
+
+		changes = append(changes, b.planCollectionDifferences(collection, collectionOptions, specification)...)
+	}
+
+	return changes
+}
+
+func (b *Bulk) planCollectionDifferences(
+	collection string, collectionOptions config.CollectionOptions, specification *mongo.CollectionSpecification,
+) []ProvisionChange {
+	var changes []ProvisionChange
+	conflict := func(detail string) {
+		changes = append(changes, ProvisionChange{Collection: collection, Action: ProvisionConflict, Detail: detail})
+	}
+
+	create, timeSeries := collectionOptions.Create, collectionOptions.TimeSeries
+
+	if isTimeSeries := specification.Type == "timeseries"; isTimeSeries != timeSeries.Enabled {
+		conflict(fmt.Sprintf("collection is of type %s, timeseries is %v", specification.Type, timeSeries.Enabled))
+	}
+
+	if capped, _ := specification.Options.Lookup("capped").BooleanOK(); capped != create.Capped {
+		conflict(fmt.Sprintf("collection capped is %v, configured %v", capped, create.Capped))
+	}
+
+	// time-series collections are clustered by their buckets whatever the configuration
+	_, err := specification.Options.LookupErr("clusteredIndex")
+	if clustered := err == nil; clustered != create.Clustered && !timeSeries.Enabled {
+		conflict(fmt.Sprintf("collection clustered is %v, configured %v", clustered, create.Clustered))
+	}
+
+	validator, _ := specification.Options.Lookup("validator").DocumentOK()
+	if create.Validator != nil && !sameDocument(validator, create.Validator) {
+		command := bson.D{{Key: "collMod", Value: collection}, {Key: "validator", Value: create.Validator}}
+		if create.ValidationLevel != "" {
+			command = append(command, bson.E{Key: "validationLevel", Value: create.ValidationLevel})
+		}
+		if create.ValidationAction != "" {
+			command = append(command, bson.E{Key: "validationAction", Value: create.ValidationAction})
+		}
+
+		changes = append(changes, ProvisionChange{
+			Collection: collection,
+			Action:     ProvisionUpdateValidator,
+			Detail:     "validator differs from the configured one",
+			apply: func(ctx context.Context) error {
+				return b.database.RunCommand(ctx, command).Err()
+			},
+		})
+	}
+
+	return changes
+}
+
+// planIndex compares the index with the existing index of the same name, indexes of a collection that does
+// not exist yet are always created.
+func (b *Bulk) planIndex(ctx context.Context, desired collectionIndex, collectionExists bool) (*ProvisionChange, error) {
+	name := indexName(desired.index)
+
+	var current *existingIndex
+	if collectionExists {
+		cursor, err := b.database.Collection(desired.collection).Indexes().List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error while listing indexes of %s: %w", desired.collection, err)
+		}
+
+		var indexes []existingIndex
+		if err := cursor.All(ctx, &indexes); err != nil {
+			return nil, fmt.Errorf("error while reading indexes of %s: %w", desired.collection, err)
+		}
+
+		for i := range indexes {
+			if indexes[i].Name == name {
+				current = &indexes[i]
+			}
+		}
+	}
+
+	if current == nil {
+		model := indexModel(desired.index)
+		return &ProvisionChange{
+			Collection: desired.collection,
+			Action:     ProvisionCreateIndex,
+			Detail:     fmt.Sprintf("index %s on %v", name, model.Keys),
+			apply: func(ctx context.Context) error {
+				_, err := b.database.Collection(desired.collection).Indexes().CreateOne(ctx, model)
+				return err
+			},
+		}, nil
+	}
+
+	if difference := indexDifference(desired.index, current); difference != "" {
+		return &ProvisionChange{
+			Collection: desired.collection,
+			Action:     ProvisionConflict,
+			Detail:     fmt.Sprintf("index %s differs in %s, drop it to recreate it", name, difference),
+		}, nil
+	}
+
+	expireAfterSeconds := int64(desired.index.ExpireAfter.Seconds())
+	if current.ExpireAfterSeconds != nil && desired.index.ExpireAfter > 0 && *current.ExpireAfterSeconds != expireAfterSeconds {
+		command := bson.D{
+			{Key: "collMod", Value: desired.collection},
+			{Key: "index", Value: bson.D{{Key: "name", Value: name}, {Key: "expireAfterSeconds", Value: expireAfterSeconds}}},
+		}
+		return &ProvisionChange{
+			Collection: desired.collection,
+			Action:     ProvisionUpdateIndexTTL,
+			Detail:     fmt.Sprintf("index %s expireAfterSeconds %d -> %d", name, *current.ExpireAfterSeconds, expireAfterSeconds),
+			apply: func(ctx context.Context) error {
+				return b.database.RunCommand(ctx, command).Err()
+			},
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// indexDifference names the first difference of the existing index that cannot be changed in place.
+func indexDifference(desired config.IndexOptions, current *existingIndex) string {
+	keys := indexKeys(desired)
+	if len(keys) != len(current.Key) {
+		return "keys"
+	}
+	for i := range keys {
+		if keys[i].Key != current.Key[i].Key || fmt.Sprint(keys[i].Value) != fmt.Sprint(current.Key[i].Value) {
+			return "keys"
+		}
+	}
+
+	switch {
+	case desired.Unique != current.Unique:
+		return "unique"
+	case (desired.ExpireAfter > 0) != (current.ExpireAfterSeconds != nil):
+		return "expireAfter"
+	case !sameDocument(current.PartialFilterExpression, desired.PartialFilter):
+		return "partialFilter"
+	case desired.Collation != nil && (current.Collation == nil || current.Collation.Locale != desired.Collation.Locale ||
+		(desired.Collation.Strength != 0 && current.Collation.Strength != desired.Collation.Strength)):
+		return "collation"
+	case desired.Collation == nil && current.Collation != nil && current.Collation.Locale != "simple":
+		return "collation"
+	}
+
+	return ""
+}
+
+// desiredIndexes are the configured indexes and the indexes the history and SCD options rely on.
+func (b *Bulk) desiredIndexes() []collectionIndex {
+	var indexes []collectionIndex
+
+	for _, collection := range b.sortedCollections() {
+		collectionOptions := b.collectionOptions[collection]
+
+		for _, index := range collectionOptions.Indexes {
+			indexes = append(indexes, collectionIndex{collection: collection, index: index})
+		}
+
+		if history := collectionOptions.History; history.Enabled && history.Retention > 0 {
+			indexes = append(indexes, collectionIndex{
+				collection: b.historyCollection(collection),
+				index:      config.IndexOptions{Keys: []config.IndexKey{{Field: "eventTime"}}, ExpireAfter: history.Retention},
+			})
+		}
+
+		if collectionOptions.SCD.Enabled {
+			indexes = append(indexes, collectionIndex{
+				collection: collection,
+				index: config.IndexOptions{
+					Name: "scd_versions",
+					Keys: []config.IndexKey{{Field: "_id.id"}, {Field: "_id.cas", Direction: -1}},
+				},
+			})
+		}
+	}
+
+	return indexes
+}
+
+func (b *Bulk) sortedCollections() []string {
+	collections := make([]string, 0, len(b.collectionOptions))
+	for collection := range b.collectionOptions {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+	return collections
+}
+
+func indexKeys(index config.IndexOptions) bson.D {
+	keys := make(bson.D, 0, len(index.Keys))
+	for _, key := range index.Keys {
+		keys = append(keys, bson.E{Key: key.Field, Value: key.Value()})
+	}
+	return keys
+}
+
+// indexName is the configured name of the index, or the name MongoDB generates from its keys.
+func indexName(index config.IndexOptions) string {
+	if index.Name != "" {
+		return index.Name
+	}
+
+	parts := make([]string, 0, len(index.Keys))
+	for _, key := range index.Keys {
+		parts = append(parts, fmt.Sprintf("%s_%v", key.Field, key.Value()))
+	}
+	return strings.Join(parts, "_")
+}
+
+func indexModel(index config.IndexOptions) mongo.IndexModel {
+	indexOptions := options.Index().SetName(indexName(index))
+	if index.Unique {
+		indexOptions.SetUnique(true)
+	}
+	if index.ExpireAfter > 0 {
+		indexOptions.SetExpireAfterSeconds(int32(index.ExpireAfter.Seconds()))
+	}
+	if index.PartialFilter != nil {
+		indexOptions.SetPartialFilterExpression(index.PartialFilter)
+	}
+	if index.Collation != nil {
+		indexOptions.SetCollation(&options.Collation{Locale: index.Collation.Locale, Strength: index.Collation.Strength})
+	}
+
+	return mongo.IndexModel{Keys: indexKeys(index), Options: indexOptions}
+}
+
+func createCollectionOptions(collectionOptions config.CollectionOptions) *options.CreateCollectionOptions {
+	create, timeSeries := collectionOptions.Create, collectionOptions.TimeSeries
+	createOptions := options.CreateCollection()
+
+	if timeSeries.Enabled {
+		timeSeriesOptions := options.TimeSeries().SetTimeField(timeSeries.TimeField)
+		if timeSeries.MetaField != "" {
+			timeSeriesOptions.SetMetaField(timeSeries.MetaField)
+		}
+		if timeSeries.Granularity != "" {
+			timeSeriesOptions.SetGranularity(timeSeries.Granularity)
+		}
+		createOptions.SetTimeSeriesOptions(timeSeriesOptions)
+
+		if timeSeries.ExpireAfter > 0 {
+			createOptions.SetExpireAfterSeconds(int64(timeSeries.ExpireAfter.Seconds()))
+		}
+	}
+
+	if create.Validator != nil {
+		createOptions.SetValidator(create.Validator)
+	}
+	if create.ValidationLevel != "" {
+		createOptions.SetValidationLevel(create.ValidationLevel)
+	}
+	if create.ValidationAction != "" {
+		createOptions.SetValidationAction(create.ValidationAction)
+	}
+	if create.Capped {
+		createOptions.SetCapped(true).SetSizeInBytes(create.SizeBytes)
+		if create.MaxDocuments > 0 {
+			createOptions.SetMaxDocuments(create.MaxDocuments)
+		}
+	}
+	if create.Clustered {
+		createOptions.SetClusteredIndex(bson.D{{Key: "key", Value: bson.D{{Key: "_id", Value: 1}}}, {Key: "unique", Value: true}})
+	}
+
+	return createOptions
+}
+
+func describeCreateOptions(collectionOptions config.CollectionOptions) string {
+	create := collectionOptions.Create
+
+	var parts []string
+	if collectionOptions.TimeSeries.Enabled {
+		parts = append(parts, "timeseries on "+collectionOptions.TimeSeries.TimeField)
+	}
+	if create.Validator != nil {
+		parts = append(parts, "validator")
+	}
+	if create.Capped {
+		parts = append(parts, fmt.Sprintf("capped to %d bytes", create.SizeBytes))
+	}
+	if create.Clustered {
+		parts = append(parts, "clustered")
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// sameDocument compares documents regardless of the order of their fields and the Go types they are built of.
+func sameDocument(current bson.Raw, desired map[string]any) bool {
+	if len(current) == 0 || desired == nil {
+		return len(current) == 0 && desired == nil
+	}
+
+	desiredBytes, err := bson.Marshal(desired)
+	if err != nil {
+		return false
+	}
+
+	var currentDocument, desiredDocument bson.M
+	if bson.Unmarshal(current, &currentDocument) != nil || bson.Unmarshal(desiredBytes, &desiredDocument) != nil {
+		return false
+	}
+
+	return fmt.Sprint(currentDocument) == fmt.Sprint(desiredDocument)
+}
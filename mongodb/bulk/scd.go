@@ -0,0 +1,218 @@
+package bulk
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	config "github.com/Trendyol/go-dcp-mongodb/configs"
+	"github.com/Trendyol/go-dcp-mongodb/mongodb"
+	"github.com/Trendyol/go-dcp/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// versionChange is a change of a document of a collection written as a slowly changing dimension of type 2.
+// It is written as a pair of models, one opening the new version and one closing the versions before it.
+type versionChange struct {
+	eventTime  time.Time
+	documentID any
+	document   bson.M
+	collection string
+	options    config.SCDOptions
+	// closedAt is resolved right before the change is written, it is set when a later change of the document is
+	// in the same batch
+	closedAt *time.Time
+	// cas identifies the version, so a change streamed again after a restart writes the same version
+	cas     int64
+	version int64
+	deleted bool
+}
+
+// versionModel is one of the two writes of a version change. The pair is written in order within an ordered
+// bulk write, opening first, so a failed open never leaves a document without an open version. Both writes
+// are idempotent, a replayed change finds its version already opened and the versions before it closed.
+type versionModel struct {
+	change *versionChange
+	open   bool
+}
+
+func (m *versionModel) Convert() *mongodb.ExecArgs {
+	return &mongodb.ExecArgs{
+		Document:  m.change.document,
+		Operation: mongodb.Insert,
+	}
+}
+
+func (m *versionModel) toWriteModel() mongo.WriteModel {
+	change := m.change
+
+	if m.open {
+		document := bson.D{}
+		for key, value := range change.document {
+			if key != "_id" {
+				document = append(document, bson.E{Key: key, Value: value})
+			}
+		}
+		document = append(document,
+			bson.E{Key: change.options.ValidFromField, Value: change.eventTime},
+			bson.E{Key: change.options.ValidToField, Value: change.closedAt},
+			bson.E{Key: change.options.VersionField, Value: change.version},
+		)
+
+		return mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": versionID(change.documentID, change.cas)}).
+			SetUpdate(bson.M{"$setOnInsert": document}).
+			SetUpsert(true)
+	}
+
+	return mongo.NewUpdateManyModel().
+		SetFilter(bson.M{
+			"_id.id":                    change.documentID,
+			"_id.cas":                   bson.M{"$lt": change.cas},
+			change.options.ValidToField: nil,
+		}).
+		SetUpdate(bson.M{"$set": bson.M{change.options.ValidToField: change.eventTime}})
+}
+
+func versionID(documentID any, cas int64) bson.D {
+	return bson.D{{Key: "id", Value: documentID}, {Key: "cas", Value: cas}}
+}
+
+// closes reports whether model is the close of the change opened by m.
+func (m *versionModel) closes(model mongodb.Model) bool {
+	next, ok := model.(*versionModel)
+	return ok && m.open && !next.open && next.change == m.change
+}
+
+// eventCas is the cas of the dcp event, or the event time for models that do not come from a dcp event.
+func eventCas(ctx *models.ListenerContext, eventTime time.Time) int64 {
+	switch event := ctx.Event.(type) {
+	case models.DcpMutation:
+		return int64(event.Cas)
+	case models.DcpDeletion:
+		return int64(event.Cas)
+	case models.DcpExpiration:
+		return int64(event.Cas)
+	default:
+		return eventTime.UnixNano()
+	}
+}
+
+// withVersions replaces the models of collections with SCD enabled by the pair of models of their version change,
+// a deletion only closes the current version.
+func (b *Bulk) withVersions(ctx *models.ListenerContext, eventTime time.Time, actions []mongodb.Model) []mongodb.Model {
+	if len(b.collectionOptions) == 0 {
+		return actions
+	}
+
+	result := make([]mongodb.Model, 0, len(actions))
+	for _, action := range actions {
+		rawModel, ok := action.(*mongodb.Raw)
+		if !ok || !b.collectionOptions[rawModel.MongoCollection].SCD.Enabled {
+			result = append(result, action)
+			continue
+		}
+
+		change := &versionChange{
+			eventTime:  eventTime,
+			documentID: rawModel.Document["_id"],
+			document:   rawModel.Document,
+			collection: rawModel.MongoCollection,
+			options:    b.collectionOptions[rawModel.MongoCollection].SCD,
+			cas:        eventCas(ctx, eventTime),
+			deleted:    rawModel.Operation == mongodb.Delete,
+		}
+		if change.documentID == nil {
+			change.documentID = rawModel.ID
+		}
+
+		if !change.deleted {
+			result = append(result, &versionModel{change: change, open: true})
+		}
+		result = append(result, &versionModel{change: change})
+	}
+
+	return result
+}
+
+// resolveVersions numbers the version changes of the batch after the versions written before them. Changes of the
+// same document within the batch get consecutive versions in order, every version but the last is opened already
+// closed. A replayed change counts the same versions before it, so it gets the number it was written with.
+// A dry run without a client numbers them from the batch alone, its writes are marked unresolved.
+func (b *Bulk) resolveVersions(ctx context.Context, items []BatchItem) error {
+	changesByCollection := make(map[string][]*versionChange)
+	for _, item := range items {
+		if model, ok := item.Model.(*versionModel); ok && !model.open {
+			changesByCollection[model.change.collection] = append(changesByCollection[model.change.collection], model.change)
+		}
+	}
+
+	for collection, changes := range changesByCollection {
+		versions := make(map[string]int64)
+		if b.database != nil {
+			var err error
+			if versions, err = b.findLatestVersions(ctx, collection, changes); err != nil {
+				return fmt.Errorf("error while reading latest versions of %s: %w", collection, err)
+			}
+		}
+
+		numberVersions(changes, versions)
+	}
+
+	return nil
+}
+
+func numberVersions(changes []*versionChange, versions map[string]int64) {
+	previousChanges := make(map[string]*versionChange, len(changes))
+	for _, change := range changes {
+		id := fmt.Sprint(change.documentID)
+		change.version = versions[id] + 1
+		if !change.deleted {
+			versions[id] = change.version
+		}
+
+		if previous, ok := previousChanges[id]; ok && !previous.deleted {
+			previous.closedAt = &change.eventTime
+		}
+		previousChanges[id] = change
+	}
+}
+
+// findLatestVersions returns the latest version of each document written before its first change in the batch.
+func (b *Bulk) findLatestVersions(ctx context.Context, collection string, changes []*versionChange) (map[string]int64, error) {
+	firstChanges := make(map[string]bson.M, len(changes))
+	conditions := make(bson.A, 0, len(changes))
+	for _, change := range changes {
+		id := fmt.Sprint(change.documentID)
+		if _, ok := firstChanges[id]; ok {
+			continue
+		}
+		firstChanges[id] = bson.M{"_id.id": change.documentID, "_id.cas": bson.M{"$lt": change.cas}}
+		conditions = append(conditions, firstChanges[id])
+	}
+
+	versionField := "$" + changes[0].options.VersionField
+	cursor, err := b.database.Collection(collection).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$or": conditions}}},
+		{{Key: "$group", Value: bson.M{"_id": "$_id.id", "version": bson.M{"$max": versionField}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		ID      any   `bson:"_id"`
+		Version int64 `bson:"version"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]int64, len(firstChanges))
+	for _, result := range results {
+		versions[fmt.Sprint(result.ID)] = result.Version
+	}
+
+	return versions, nil
+}
@@ -0,0 +1,176 @@
+package bulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	config "github.com/Trendyol/go-dcp-mongodb/configs"
+	"github.com/Trendyol/go-dcp-mongodb/mongodb"
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// compileSchemas compiles the JSON Schemas of the collection options, keyed by collection.
+func compileSchemas(collectionOptions map[string]config.CollectionOptions) (map[string]*jsonschema.Schema, error) {
+	schemas := make(map[string]*jsonschema.Schema)
+
+	for collection, options := range collectionOptions {
+		if !options.Schema.IsEnabled() {
+			continue
+		}
+
+		url := options.Schema.File
+		compiler := jsonschema.NewCompiler()
+
+		if options.Schema.Inline != nil {
+			inline, err := json.Marshal(options.Schema.Inline)
+			if err != nil {
+				return nil, fmt.Errorf("error while reading inline schema of %s: %w", collection, err)
+			}
+
+			url = collection + ".schema.json"
+			if err := compiler.AddResource(url, bytes.NewReader(inline)); err != nil {
+				return nil, fmt.Errorf("error while reading inline schema of %s: %w", collection, err)
+			}
+		}
+
+		schema, err := compiler.Compile(url)
+		if err != nil {
+			return nil, fmt.Errorf("error while compiling schema of %s: %w", collection, err)
+		}
+
+		schemas[collection] = schema
+	}
+
+	return schemas, nil
+}
+
+// validateDocuments validates the documents written by the models against the schema of their collection and
+// applies the schema policy to the invalid ones. An error is returned when an invalid document halts the connector.
+func (b *Bulk) validateDocuments(actions []mongodb.Model) ([]mongodb.Model, error) {
+	if len(b.schemas) == 0 {
+		return actions, nil
+	}
+
+	result := make([]mongodb.Model, 0, len(actions))
+	for _, action := range actions {
+		rawModel, ok := action.(*mongodb.Raw)
+		if !ok || rawModel.Operation == mongodb.Delete || b.schemas[rawModel.MongoCollection] == nil {
+			result = append(result, action)
+			continue
+		}
+
+		err := b.schemas[rawModel.MongoCollection].Validate(toJSONValue(rawModel.Document))
+		if err == nil {
+			result = append(result, action)
+			continue
+		}
+
+		schema := b.collectionOptions[rawModel.MongoCollection].Schema
+		b.metricsRecorder.RecordSchemaViolation(rawModel.MongoCollection, schema.Policy)
+
+		switch schema.Policy {
+		case config.SchemaPolicySkip:
+			logger.Log.Debug("skipping document %v of collection %s failing schema validation: %v", rawModel.ID, rawModel.MongoCollection, err)
+		case config.SchemaPolicyFlag:
+			result = append(result, flagDocument(rawModel, schema.FlagField, err))
+		case config.SchemaPolicyHalt:
+			return nil, fmt.Errorf("document %v of collection %s failed schema validation: %w", rawModel.ID, rawModel.MongoCollection, err)
+		default:
+			b.rejectDocument(rawModel.MongoCollection, action, fmt.Errorf("schema validation failed: %w", err))
+		}
+	}
+
+	return result, nil
+}
+
+// flagDocument copies the model with the validation errors of its document in the flag field.
+func flagDocument(rawModel *mongodb.Raw, flagField string, err error) *mongodb.Raw {
+	document := make(bson.M, len(rawModel.Document)+1)
+	for key, value := range rawModel.Document {
+		document[key] = value
+	}
+	document[flagField] = validationErrors(err)
+
+	flagged := *rawModel
+	flagged.Document = document
+	return &flagged
+}
+
+// validationErrors lists the leaf causes of a validation error with the location of the invalid value.
+func validationErrors(err error) bson.A {
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return bson.A{err.Error()}
+	}
+
+	var messages bson.A
+	var collect func(validationErr *jsonschema.ValidationError)
+	collect = func(validationErr *jsonschema.ValidationError) {
+		if len(validationErr.Causes) == 0 {
+			messages = append(messages, fmt.Sprintf("%s: %s", validationErr.InstanceLocation, validationErr.Message))
+		}
+		for _, cause := range validationErr.Causes {
+			collect(cause)
+		}
+	}
+	collect(validationErr)
+
+	return messages
+}
+
+// toJSONValue converts a document to the types a JSON decoder produces, which the schema validator expects.
+// BSON types without a JSON counterpart, such as dates and object ids, are validated as strings.
+func toJSONValue(value any) any {
+	switch v := value.(type) {
+	case nil, bool, string, float32, float64, int, int8, int32, int64, uint, uint8, uint32, uint64, json.Number:
+		return v
+	case int16:
+		return int(v)
+	case uint16:
+		return uint(v)
+	case bson.M:
+		return toJSONObject(v)
+	case map[string]any:
+		return toJSONObject(v)
+	case bson.D:
+		object := make(map[string]any, len(v))
+		for _, field := range v {
+			object[field.Key] = toJSONValue(field.Value)
+		}
+		return object
+	case bson.A:
+		return toJSONArray(v)
+	case []any:
+		return toJSONArray(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case primitive.DateTime:
+		return v.Time().UTC().Format(time.RFC3339Nano)
+	case primitive.ObjectID:
+		return v.Hex()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toJSONObject(document map[string]any) map[string]any {
+	object := make(map[string]any, len(document))
+	for key, value := range document {
+		object[key] = toJSONValue(value)
+	}
+	return object
+}
+
+func toJSONArray(values []any) []any {
+	array := make([]any, len(values))
+	for i, value := range values {
+		array[i] = toJSONValue(value)
+	}
+	return array
+}
@@ -0,0 +1,150 @@
+package bulk
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Trendyol/go-dcp-mongodb/mongodb"
+	"github.com/Trendyol/go-dcp/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// measurement is a document inserted into a time-series collection. Measurements are never deduplicated,
+// every mutation of a document is kept.
+type measurement struct {
+	document   bson.M
+	collection string
+}
+
+func (m *measurement) Convert() *mongodb.ExecArgs {
+	return &mongodb.ExecArgs{
+		Document:  m.document,
+		Operation: mongodb.Insert,
+	}
+}
+
+// checkTimeSeriesCollections fails unless every time-series collection exists as one. Inserting a measurement into a
+// missing collection would create a regular collection, e.g. when provisioning is disabled or only a dry run.
+func (b *Bulk) checkTimeSeriesCollections(ctx context.Context) error {
+	if b.sink != nil {
+		return nil
+	}
+
+	var collections []string
+	for _, collection := range b.sortedCollections() {
+		if b.collectionOptions[collection].TimeSeries.Enabled {
+			collections = append(collections, collection)
+		}
+	}
+	if len(collections) == 0 {
+		return nil
+	}
+
+	specifications, err := b.database.ListCollectionSpecifications(ctx, bson.M{"name": bson.M{"$in": collections}})
+	if err != nil {
+		return fmt.Errorf("error while listing time-series collections: %w", err)
+	}
+
+	return verifyTimeSeriesCollections(collections, specifications)
+}
+
+func verifyTimeSeriesCollections(collections []string, specifications []*mongo.CollectionSpecification) error {
+	types := make(map[string]string, len(specifications))
+	for _, specification := range specifications {
+		types[specification.Name] = specification.Type
+	}
+
+	for _, collection := range collections {
+		collectionType, ok := types[collection]
+		switch {
+		case !ok:
+			return fmt.Errorf("time-series collection %s does not exist, enable provisioning or create it", collection)
+		case collectionType != "timeseries":
+			return fmt.Errorf("collection %s is configured as time-series but is of type %s", collection, collectionType)
+		}
+	}
+
+	return nil
+}
+
+// withTimeSeries replaces the models of time-series collections by measurements. Deletions and expirations have no
+// measurement and are dropped, documents whose time field cannot be read as a time are rejected.
+func (b *Bulk) withTimeSeries(eventTime time.Time, actions []mongodb.Model) []mongodb.Model {
+	if len(b.collectionOptions) == 0 {
+		return actions
+	}
+
+	result := make([]mongodb.Model, 0, len(actions))
+	for _, action := range actions {
+		rawModel, ok := action.(*mongodb.Raw)
+		if !ok || !b.collectionOptions[rawModel.MongoCollection].TimeSeries.Enabled {
+			result = append(result, action)
+			continue
+		}
+
+		if rawModel.Operation == mongodb.Delete {
+			logger.Log.Debug("skipping delete of %v, time-series collection %s has no deletes", rawModel.ID, rawModel.MongoCollection)
+			continue
+		}
+
+		document, err := b.toMeasurement(rawModel, eventTime)
+		if err != nil {
+			b.rejectDocument(rawModel.MongoCollection, action, err)
+			continue
+		}
+
+		result = append(result, &measurement{document: document, collection: rawModel.MongoCollection})
+	}
+
+	return result
+}
+
+func (b *Bulk) toMeasurement(rawModel *mongodb.Raw, eventTime time.Time) (bson.M, error) {
+	timeSeries := b.collectionOptions[rawModel.MongoCollection].TimeSeries
+
+	sourceField := timeSeries.SourceField
+	if sourceField == "" {
+		sourceField = timeSeries.TimeField
+	}
+
+	measurementTime := eventTime
+	if value, ok := rawModel.Document[sourceField]; ok && value != nil {
+		var err error
+		if measurementTime, err = asTime(value); err != nil {
+			return nil, fmt.Errorf("time field %s: %w", sourceField, err)
+		}
+	}
+
+	document := make(bson.M, len(rawModel.Document)+1)
+	for key, value := range rawModel.Document {
+		document[key] = value
+	}
+	document[timeSeries.TimeField] = measurementTime
+
+	return document, nil
+}
+
+// asTime reads a time from a BSON date, an RFC 3339 string or a number of milliseconds since the epoch.
+func asTime(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case primitive.DateTime:
+		return v.Time(), nil
+	case string:
+		return time.Parse(time.RFC3339Nano, v)
+	case float64:
+		return time.UnixMilli(int64(v)), nil
+	case int64:
+		return time.UnixMilli(v), nil
+	case int32:
+		return time.UnixMilli(int64(v)), nil
+	case int:
+		return time.UnixMilli(int64(v)), nil
+	default:
+		return time.Time{}, fmt.Errorf("unsupported time value of type %T", value)
+	}
+}
@@ -0,0 +1,196 @@
+package bulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	config "github.com/Trendyol/go-dcp-mongodb/configs"
+	"github.com/Trendyol/go-dcp-mongodb/mongodb"
+	"github.com/Trendyol/go-dcp/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrTransactionAborted is passed to OnDocumentFailed for the documents of a transaction that was aborted because
+// MongoDB rejected another document of it.
+var ErrTransactionAborted = errors.New("transaction aborted by a rejected document")
+
+// rejectedTransaction is returned by a transaction aborted because MongoDB rejected documents of collection,
+// the indexes of the write errors refer to the items of that collection.
+type rejectedTransaction struct {
+	collection  string
+	writeErrors []mongo.BulkWriteError
+}
+
+func (r *rejectedTransaction) Error() string {
+	return fmt.Sprintf("transaction aborted, %d documents of collection %s rejected: %v",
+		len(r.writeErrors), r.collection, r.writeErrors[0])
+}
+
+// checkTransactionSupport fails when the deployment cannot run multi-document transactions.
+func checkTransactionSupport(ctx context.Context, database *mongo.Database) error {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+
+	if err := database.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return fmt.Errorf("error while checking transaction support: %w", err)
+	}
+
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		return fmt.Errorf("transactions require a replica set or a sharded cluster")
+	}
+
+	return nil
+}
+
+// eventTransactions splits the batch into the items of each event, in the order of the events.
+func eventTransactions(batch []BatchItem) [][]BatchItem {
+	groupIndexes := make(map[int]int)
+	var groups [][]BatchItem
+	for _, item := range batch {
+		index, ok := groupIndexes[item.Event]
+		if !ok {
+			index = len(groups)
+			groupIndexes[item.Event] = index
+			groups = append(groups, nil)
+		}
+		groups[index] = append(groups[index], item)
+	}
+
+	// an item replaced by a later event of the same document keeps its position in the batch
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i][0].Event < groups[j][0].Event
+	})
+
+	return groups
+}
+
+func (b *Bulk) transactionalRequest(ctx context.Context, batch []BatchItem) error {
+	return b.runTransactions(ctx, batch, b.writeTransaction)
+}
+
+// runTransactions writes the batch in a single transaction for the batch scope and retries it as transactions of
+// each event when MongoDB rejects a document, so only the events of the rejected documents are dead-lettered.
+// Transactions of events are written one at a time in the order of the events, since filter based models of
+// different events may write the same documents.
+func (b *Bulk) runTransactions(
+	ctx context.Context, batch []BatchItem, write func(ctx context.Context, items []BatchItem) error,
+) error {
+	var rejected *rejectedTransaction
+
+	if b.transaction.Scope == config.TransactionScopeBatch {
+		err := write(ctx, batch)
+		if !errors.As(err, &rejected) {
+			return err
+		}
+		logger.Log.Warn("retrying batch as transactions of each event: %v", rejected)
+	}
+
+	for _, items := range eventTransactions(batch) {
+		err := write(ctx, items)
+		if errors.As(err, &rejected) {
+			logger.Log.Error("%v", rejected)
+			b.rejectTransaction(items, rejected)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rejectTransaction passes the rejected documents to OnDocumentFailed with their errors and the other documents of
+// the transaction with ErrTransactionAborted.
+func (b *Bulk) rejectTransaction(items []BatchItem, rejected *rejectedTransaction) {
+	for collectionName, groupItems := range groupByCollection(items) {
+		writeErrors := make(map[int]mongo.BulkWriteError)
+		if collectionName == rejected.collection {
+			for _, writeErr := range rejected.writeErrors {
+				writeErrors[writeErr.Index] = writeErr
+			}
+		}
+
+		for i, item := range groupItems {
+			if writeErr, ok := writeErrors[i]; ok {
+				b.documentFailed(collectionName, item, writeErr)
+			} else {
+				b.documentFailed(collectionName, item, ErrTransactionAborted)
+			}
+		}
+	}
+}
+
+func groupByCollection(items []BatchItem) map[string][]BatchItem {
+	collectionItems := make(map[string][]BatchItem)
+	for _, item := range items {
+		if collection, ok := collectionOf(item.Model); ok {
+			collectionItems[collection] = append(collectionItems[collection], item)
+		}
+	}
+	return collectionItems
+}
+
+// writeTransaction applies the items to their collections in one transaction. Transient errors and unknown commit
+// results are retried by the driver until the transaction timeout, documents rejected by MongoDB abort the whole
+// transaction and a rejectedTransaction is returned.
+func (b *Bulk) writeTransaction(ctx context.Context, items []BatchItem) error {
+	collectionItems := groupByCollection(items)
+
+	session, err := b.client.StartSession()
+	if err != nil {
+		return fmt.Errorf("error while starting session: %w", err)
+	}
+
+	transactionCtx, cancel := context.WithTimeout(ctx, b.transaction.Timeout)
+	defer cancel()
+	defer session.EndSession(transactionCtx)
+
+	results := make(map[string]*mongo.BulkWriteResult, len(collectionItems))
+	var failedCollection string
+
+	_, err = session.WithTransaction(transactionCtx, func(sessionCtx mongo.SessionContext) (any, error) {
+		for collectionName, groupItems := range collectionItems {
+			writeModels := make([]mongo.WriteModel, 0, len(groupItems))
+			for _, item := range groupItems {
+				writeModels = append(writeModels, b.buildWriteModel(item))
+			}
+
+			result, err := b.database.Collection(collectionName).BulkWrite(sessionCtx, writeModels, options.BulkWrite())
+			if err != nil {
+				failedCollection = collectionName
+				return nil, err
+			}
+			results[collectionName] = result
+		}
+		return nil, nil
+	})
+
+	if err == nil {
+		for collectionName, result := range results {
+			b.recordSuccess(collectionName, result)
+		}
+		return nil
+	}
+
+	var mongoErr mongo.BulkWriteException
+	if errors.As(err, &mongoErr) && len(mongoErr.WriteErrors) > 0 {
+		return &rejectedTransaction{collection: failedCollection, writeErrors: mongoErr.WriteErrors}
+	}
+
+	for collectionName, groupItems := range collectionItems {
+		b.hooks.BulkError(mongodb.BulkErrorContext{
+			Err:        err,
+			Collection: collectionName,
+			Count:      len(groupItems),
+		})
+	}
+
+	return fmt.Errorf("transaction error: %w", err)
+}
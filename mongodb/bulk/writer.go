@@ -0,0 +1,256 @@
+package bulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Trendyol/go-dcp-mongodb/mongodb"
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
+)
+
+var errBulkClosed = errors.New("bulk is closed")
+
+// pendingBatch is a batch handed over to the writer goroutine while a fresh batch keeps accepting events.
+type pendingBatch struct {
+	done     chan error
+	items    []BatchItem
+	size     int
+	byteSize int
+}
+
+// handoff swaps the current batch with an empty one and queues it for the writer. It waits for a writer slot while
+// maxInFlightBatches batches are already queued or being written, so batches are always written in the order they
+// were filled.
+func (p *partition) handoff(ctx context.Context) (*pendingBatch, error) {
+	p.handoffLock.Lock()
+	defer p.handoffLock.Unlock()
+
+	if err := p.acquireSlot(ctx); err != nil {
+		return nil, err
+	}
+
+	pending, err := p.detach()
+	if pending == nil {
+		p.releaseSlot()
+		return nil, err
+	}
+
+	p.queue(pending)
+	return pending, nil
+}
+
+// acquireSlot takes one of the maxInFlightBatches writer slots, a slot is released once its batch is written.
+func (p *partition) acquireSlot(ctx context.Context) error {
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("error while waiting for a writer on partition %d: %w", p.id, ctx.Err())
+	}
+}
+
+func (p *partition) releaseSlot() {
+	<-p.slots
+}
+
+// detach swaps the current batch with an empty one. Must be called with handoffLock and a writer slot held.
+func (p *partition) detach() (*pendingBatch, error) {
+	p.flushLock.Lock()
+	defer p.flushLock.Unlock()
+
+	if p.isClosed {
+		return nil, errBulkClosed
+	}
+
+	if p.bulk.isDcpRebalancing {
+		return nil, nil
+	}
+
+	pending := &pendingBatch{
+		done:     make(chan error, 1),
+		items:    p.batch,
+		size:     p.batchSize,
+		byteSize: p.batchByteSize,
+	}
+	p.resetBatch()
+
+	return pending, nil
+}
+
+// queue passes a detached batch to the writer, which never blocks since flushCh has room for a batch of every slot.
+// Must be called with handoffLock held.
+func (p *partition) queue(pending *pendingBatch) {
+	p.inFlightBatches.Add(1)
+	p.flushCh <- pending
+}
+
+// close rejects further batches and lets the writer exit once the queued batches are written.
+func (p *partition) close() {
+	p.handoffLock.Lock()
+	defer p.handoffLock.Unlock()
+
+	p.flushLock.Lock()
+	p.isClosed = true
+	p.flushLock.Unlock()
+
+	p.batchTicker.Stop()
+	close(p.flushCh)
+}
+
+func (p *partition) runWriter() {
+	defer close(p.writerDone)
+
+	for pending := range p.flushCh {
+		err := p.writeBatch(pending)
+		p.inFlightBatches.Add(-1)
+		p.releaseSlot()
+		p.bulk.releaseBuffered(pending.size, pending.byteSize)
+		pending.done <- err
+	}
+}
+
+func (p *partition) writeBatch(pending *pendingBatch) error {
+	b := p.bulk
+
+	// nothing is committed once a batch failed, later batches are skipped so the partition keeps the order of events
+	if p.writeErr != nil {
+		return fmt.Errorf("batch skipped after previous bulk request failure: %w", p.writeErr)
+	}
+
+	if len(pending.items) > 0 {
+		startedTime := time.Now()
+
+		if err := b.prepareBatch(b.writeCtx, pending.items); err != nil {
+			p.writeErr = fmt.Errorf("error while preparing batch on partition %d: %w", p.id, err)
+			b.reportError(p.writeErr)
+			return p.writeErr
+		}
+
+		if err := b.bulkRequest(b.writeCtx, pending.items); err != nil {
+			p.writeErr = fmt.Errorf("error while bulk request on partition %d: %w", p.id, err)
+			b.reportError(p.writeErr)
+			return p.writeErr
+		}
+
+		b.hooks.Flush(mongodb.FlushContext{
+			Size:     pending.size,
+			ByteSize: pending.byteSize,
+			Duration: time.Since(startedTime),
+		})
+	}
+
+	b.setLastFlushTime(time.Now())
+
+	return nil
+}
+
+// flushAndCommit hands the batches of all partitions over and commits the offsets they cover once they and the batches
+// before them are written. New events are only held off while the batches are swapped, the listener keeps filling new
+// batches while they are written. Nothing is committed when a batch fails.
+func (b *Bulk) flushAndCommit(ctx context.Context) error {
+	if b.isDcpRebalancing {
+		return nil
+	}
+
+	offsets, pendings, err := b.handoffAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, pending := range pendings {
+		select {
+		case err := <-pending.done:
+			errs = append(errs, err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	b.commit(offsets)
+	return nil
+}
+
+// handoffAll swaps the batches of all partitions at once and takes the offsets tracked up to that point, which are
+// covered by the swapped batches and the batches before them since events are acked as they are added. The writer
+// slots are taken first, so the swap never waits for MongoDB.
+func (b *Bulk) handoffAll(ctx context.Context) (map[uint16]*models.Offset, []*pendingBatch, error) {
+	for _, p := range b.partitions {
+		p.handoffLock.Lock()
+	}
+	defer func() {
+		for _, p := range b.partitions {
+			p.handoffLock.Unlock()
+		}
+	}()
+
+	for i, p := range b.partitions {
+		if err := p.acquireSlot(ctx); err != nil {
+			for _, acquired := range b.partitions[:i] {
+				acquired.releaseSlot()
+			}
+			return nil, nil, err
+		}
+	}
+
+	b.eventLock.Lock()
+	detached := make([]*pendingBatch, len(b.partitions))
+	var err error
+	for i, p := range b.partitions {
+		detached[i], err = p.detach()
+		if err != nil {
+			break
+		}
+	}
+	offsets := b.offsets.snapshot()
+	b.eventLock.Unlock()
+
+	pendings := make([]*pendingBatch, 0, len(b.partitions))
+	for i, p := range b.partitions {
+		if detached[i] == nil {
+			p.releaseSlot()
+			continue
+		}
+		p.queue(detached[i])
+		pendings = append(pendings, detached[i])
+	}
+
+	return offsets, pendings, err
+}
+
+// runCommitTicker commits every commitTickerDuration, or every batch tickerDuration when it is not set.
+func (b *Bulk) runCommitTicker(done <-chan struct{}) {
+	commitTicker := b.batchCommitTicker
+	if commitTicker == nil {
+		commitTicker = time.NewTicker(b.batchTickerDuration)
+		defer commitTicker.Stop()
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-commitTicker.C:
+			// failed batches are reported by the writers, the checkpoint just stays where it is
+			if err := b.flushAndCommit(b.writeCtx); err != nil {
+				logger.Log.Debug("checkpoint not committed: %v", err)
+			}
+		}
+	}
+}
+
+// prepareBatch resolves the parts of the models that depend on the documents in MongoDB right before they are written.
+func (b *Bulk) prepareBatch(ctx context.Context, items []BatchItem) error {
+	if err := b.resolveHistoryChanges(ctx, items); err != nil {
+		return err
+	}
+
+	return b.resolveVersions(ctx, items)
+}
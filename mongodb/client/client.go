@@ -33,6 +33,8 @@ func NewMongoClient(cfg config.MongoDB) (*mongo.Client, error) {
 	clientOpts.SetServerSelectionTimeout(time.Duration(cfg.Timeouts.ServerSelectionTimeoutMS) * time.Millisecond)
 	clientOpts.SetSocketTimeout(time.Duration(cfg.Timeouts.SocketTimeoutMS) * time.Millisecond)
 
+	applyDriverOptions(clientOpts, cfg.Driver)
+
 	client, err := mongo.Connect(ctx, clientOpts)
 	if err != nil {
 		return nil, err
@@ -52,3 +54,34 @@ func NewMongoClient(cfg config.MongoDB) (*mongo.Client, error) {
 
 	return client, nil
 }
+
+// applyDriverOptions sets only the configured options, so the driver and URI defaults apply otherwise.
+func applyDriverOptions(clientOpts *options.ClientOptions, driver config.Driver) {
+	if len(driver.Compressors) > 0 {
+		clientOpts.SetCompressors(driver.Compressors)
+	}
+
+	if driver.AppName != "" {
+		clientOpts.SetAppName(driver.AppName)
+	}
+
+	if driver.ReplicaSet != "" {
+		clientOpts.SetReplicaSet(driver.ReplicaSet)
+	}
+
+	if driver.HeartbeatIntervalMS > 0 {
+		clientOpts.SetHeartbeatInterval(time.Duration(driver.HeartbeatIntervalMS) * time.Millisecond)
+	}
+
+	if driver.LocalThresholdMS > 0 {
+		clientOpts.SetLocalThreshold(time.Duration(driver.LocalThresholdMS) * time.Millisecond)
+	}
+
+	if driver.MaxConnecting > 0 {
+		clientOpts.SetMaxConnecting(driver.MaxConnecting)
+	}
+
+	if driver.DirectConnection {
+		clientOpts.SetDirect(true)
+	}
+}
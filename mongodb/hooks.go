@@ -0,0 +1,59 @@
+package mongodb
+
+import "time"
+
+type BulkErrorContext struct {
+	Err        error
+	Collection string
+	Count      int
+}
+
+type DocumentFailedContext struct {
+	Model      Model
+	Err        error
+	Collection string
+	Code       int
+}
+
+type FlushContext struct {
+	Duration time.Duration
+	Size     int
+	ByteSize int
+}
+
+type CommitContext struct {
+	Time time.Time
+}
+
+// Hooks are invoked by the bulk layer and every hook may be called concurrently, each partition writes and flushes
+// its batches on its own writer. Only calls of OnCommit never overlap each other.
+type Hooks struct {
+	OnBulkError      func(ctx BulkErrorContext)
+	OnDocumentFailed func(ctx DocumentFailedContext)
+	OnFlush          func(ctx FlushContext)
+	OnCommit         func(ctx CommitContext)
+}
+
+func (h Hooks) BulkError(ctx BulkErrorContext) {
+	if h.OnBulkError != nil {
+		h.OnBulkError(ctx)
+	}
+}
+
+func (h Hooks) DocumentFailed(ctx DocumentFailedContext) {
+	if h.OnDocumentFailed != nil {
+		h.OnDocumentFailed(ctx)
+	}
+}
+
+func (h Hooks) Flush(ctx FlushContext) {
+	if h.OnFlush != nil {
+		h.OnFlush(ctx)
+	}
+}
+
+func (h Hooks) Commit(ctx CommitContext) {
+	if h.OnCommit != nil {
+		h.OnCommit(ctx)
+	}
+}
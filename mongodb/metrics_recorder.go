@@ -8,3 +8,17 @@ type MetricsRecorder interface {
 	RecordProcessLatency(latencyMs int64)
 	RecordBulkRequestProcessLatency(latencyMs int64)
 }
+
+// ExtendedMetricsRecorder records the metrics added after MetricsRecorder, it is kept apart so existing
+// implementations of MetricsRecorder keep compiling.
+type ExtendedMetricsRecorder interface {
+	MetricsRecorder
+	RecordUpdateMatched(collection string, count int64)
+	RecordBatchSizeLimit(sizeLimit int64)
+	RecordConcurrentRequest(concurrentRequest int64)
+	RecordBufferedDocuments(count int64)
+	RecordBufferedBytes(size int64)
+	RecordBackpressureBlockedTime(blockedMs int64)
+	RecordDuplicateKey(collection string, policy string)
+	RecordSchemaViolation(collection string, policy string)
+}
@@ -1,6 +1,9 @@
 package mongodb
 
-import "go.mongodb.org/mongo-driver/bson"
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
 
 type OperationType string
 
@@ -9,6 +12,8 @@ const (
 	Update OperationType = "update"
 	Delete OperationType = "delete"
 	Upsert OperationType = "upsert"
+	// Merge upserts the document by deep-merging its fields into the existing document instead of replacing it.
+	Merge OperationType = "merge"
 )
 
 type Model interface {
@@ -22,6 +27,36 @@ type Raw struct {
 	MongoCollection string
 }
 
+// DeleteMany deletes every document matching Filter, e.g. the children of a deleted parent document.
+// MongoCollection is set from the collection mapping like for Raw.
+type DeleteMany struct {
+	Filter          bson.M
+	MongoCollection string
+}
+
+// UpdateMany applies Update, an update document such as bson.M{"$set": ...}, to every document matching Filter.
+// MongoCollection is set from the collection mapping like for Raw.
+type UpdateMany struct {
+	Filter          bson.M
+	Update          bson.M
+	MongoCollection string
+	Upsert          bool
+}
+
+// PipelineUpdate updates the document matching Filter, or the document with ID when Filter is nil, with an
+// aggregation pipeline such as []bson.D{{{Key: "$set", Value: ...}}}, so fields can be computed on the server.
+// MongoCollection is set from the collection mapping like for Raw. There are no array filters, MongoDB rejects them on
+// pipeline updates.
+type PipelineUpdate struct {
+	Filter          bson.M
+	Hint            any
+	Collation       *options.Collation
+	ID              string
+	MongoCollection string
+	Pipeline        []bson.D
+	Upsert          bool
+}
+
 type ExecArgs struct {
 	Document  bson.M
 	Operation OperationType
@@ -33,3 +68,32 @@ func (r *Raw) Convert() *ExecArgs {
 		Operation: r.Operation,
 	}
 }
+
+func (d *DeleteMany) Convert() *ExecArgs {
+	return &ExecArgs{
+		Document:  d.Filter,
+		Operation: Delete,
+	}
+}
+
+func (u *UpdateMany) Convert() *ExecArgs {
+	return &ExecArgs{
+		Document:  u.Update,
+		Operation: Update,
+	}
+}
+
+func (p *PipelineUpdate) Convert() *ExecArgs {
+	return &ExecArgs{
+		Document:  p.GetFilter(),
+		Operation: Update,
+	}
+}
+
+// GetFilter returns Filter, or a filter on ID when Filter is nil.
+func (p *PipelineUpdate) GetFilter() bson.M {
+	if p.Filter != nil {
+		return p.Filter
+	}
+	return bson.M{"_id": p.ID}
+}
@@ -0,0 +1,101 @@
+package dcpmongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Trendyol/go-dcp-mongodb/mongodb/bulk"
+	dcpconfig "github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
+)
+
+// ErrSnapshotInterrupted is returned by Snapshot when the connector stops before the streams reached the high seqnos
+// they had when the snapshot started.
+var ErrSnapshotInterrupted = errors.New("snapshot interrupted before reaching the high seqnos")
+
+// SnapshotResult is the outcome of a snapshot. Collections holds the documents written to each collection.
+type SnapshotResult struct {
+	StartTime   time.Time                       `json:"startTime"`
+	EndTime     time.Time                       `json:"endTime"`
+	Collections map[string]bulk.CollectionStats `json:"collections"`
+}
+
+func (r SnapshotResult) Duration() time.Duration {
+	return r.EndTime.Sub(r.StartTime)
+}
+
+// streamEventHandler completes a snapshot when the streams of the finite dcp mode end, before go-dcp closes the
+// client so the checkpoint can still be committed. The streams also stop to rebalance, which is ignored.
+type streamEventHandler struct {
+	models.EmptyEventHandler
+	connector *connector
+}
+
+func (h *streamEventHandler) BeforeRebalanceStart() {
+	h.connector.isRebalancing.Store(true)
+}
+
+func (h *streamEventHandler) AfterRebalanceEnd() {
+	h.connector.isRebalancing.Store(false)
+}
+
+func (h *streamEventHandler) BeforeStreamStop() {
+	if h.connector.isRebalancing.Load() || !h.connector.dcp.GetConfig().IsDcpModeFinite() {
+		return
+	}
+
+	h.connector.completeSnapshot()
+}
+
+// Snapshot streams the documents up to the high seqnos of the vbuckets at the start, flushes and commits them,
+// then stops and returns the documents written per collection. Call Shutdown afterwards to disconnect.
+func (c *connector) Snapshot(ctx context.Context) (SnapshotResult, error) {
+	c.dcp.GetConfig().Dcp.Mode = dcpconfig.DcpModeFinite
+
+	if err := c.StartWithContext(ctx); err != nil {
+		return SnapshotResult{}, err
+	}
+
+	c.snapshotLock.Lock()
+	defer c.snapshotLock.Unlock()
+
+	if c.snapshotResult == nil {
+		return SnapshotResult{}, ErrSnapshotInterrupted
+	}
+
+	return *c.snapshotResult, nil
+}
+
+// completeSnapshot flushes and commits the batch once the streams ended on their own. Streams closed by the
+// connector or by a signal stopped before the high seqnos and leave the snapshot incomplete.
+func (c *connector) completeSnapshot() {
+	if c.isCloseRequested.Load() || len(c.signals) > 0 {
+		logger.Log.Info("snapshot interrupted, the remaining batch is left to shutdown")
+		return
+	}
+
+	err := c.bulk.ForceFlush(context.Background())
+
+	c.snapshotLock.Lock()
+	defer c.snapshotLock.Unlock()
+
+	if err != nil {
+		c.snapshotErr = err
+		return
+	}
+
+	result := &SnapshotResult{
+		StartTime:   c.startTime,
+		EndTime:     time.Now(),
+		Collections: c.bulk.Status().Collections,
+	}
+	c.snapshotResult = result
+
+	for collection, stats := range result.Collections {
+		logger.Log.Info("snapshot of %s completed, updated: %d, deleted: %d, failed: %d",
+			collection, stats.UpdateSuccess, stats.DeleteSuccess, stats.UpdateError+stats.DeleteError)
+	}
+	logger.Log.Info("snapshot completed in %v", result.Duration())
+}
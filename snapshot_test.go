@@ -0,0 +1,202 @@
+package dcpmongodb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	godcp "github.com/Trendyol/go-dcp"
+	config "github.com/Trendyol/go-dcp-mongodb/configs"
+	"github.com/Trendyol/go-dcp-mongodb/mongodb"
+	"github.com/Trendyol/go-dcp-mongodb/mongodb/bulk"
+	dcpconfig "github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// fakeDcp runs stream in Start and stops the streams on Close, calling BeforeStreamStop like go-dcp does.
+type fakeDcp struct {
+	godcp.Dcp
+	config  *dcpconfig.Dcp
+	handler models.EventHandler
+	stream  func(d *fakeDcp)
+	closed  chan struct{}
+	commits atomic.Int32
+}
+
+func newFakeDcp(stream func(d *fakeDcp)) *fakeDcp {
+	return &fakeDcp{config: &dcpconfig.Dcp{}, stream: stream, closed: make(chan struct{})}
+}
+
+func (d *fakeDcp) WaitUntilReady() chan struct{} {
+	ready := make(chan struct{})
+	close(ready)
+	return ready
+}
+
+func (d *fakeDcp) Start() {
+	d.stream(d)
+}
+
+func (d *fakeDcp) Close() {
+	close(d.closed)
+}
+
+func (d *fakeDcp) Commit() {
+	d.commits.Add(1)
+}
+
+func (d *fakeDcp) GetConfig() *dcpconfig.Dcp {
+	return d.config
+}
+
+func (d *fakeDcp) SetEventHandler(handler models.EventHandler) {
+	d.handler = handler
+}
+
+// endStreams writes an event and ends the streams as the finite mode does at the high seqnos.
+func endStreams(c *connector) func(d *fakeDcp) {
+	return func(d *fakeDcp) {
+		c.bulk.AddActions(&models.ListenerContext{Ack: func() {}}, time.Now(), []mongodb.Model{
+			&mongodb.Raw{ID: "doc1", Document: bson.M{"_id": "doc1"}, Operation: mongodb.Upsert},
+		}, "_default", 0)
+		d.handler.BeforeStreamStop()
+	}
+}
+
+// waitForClose keeps the streams open until the connector closes them.
+func waitForClose(d *fakeDcp) {
+	<-d.closed
+	d.handler.BeforeStreamStop()
+}
+
+type failingSink struct {
+	err error
+}
+
+func (s failingSink) Write(context.Context, []bulk.Write) error {
+	return s.err
+}
+
+func newTestConnector(t *testing.T, sink bulk.WriteSink, stream func(c *connector) func(d *fakeDcp)) (*connector, *fakeDcp) {
+	logger.InitDefaultLogger(logger.ERROR)
+
+	mongoClient, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:27017"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{MongoDB: config.MongoDB{
+		Connection:        config.Connection{Database: "test_db"},
+		CollectionMapping: map[string]string{"_default": "users"},
+		Provisioning:      config.Provisioning{Disabled: true},
+		DryRun:            config.DryRun{Commit: true},
+	}}
+	cfg.ApplyDefaults()
+
+	c := &connector{config: cfg}
+	dcp := newFakeDcp(nil)
+	dcp.stream = stream(c)
+	c.dcp = dcp
+	dcp.SetEventHandler(&streamEventHandler{connector: c})
+
+	if c.bulk, err = bulk.NewBulk(cfg, dcp.Commit, mongoClient, mongodb.Hooks{}, sink); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = c.bulk.Shutdown(context.Background())
+		_ = mongoClient.Disconnect(context.Background())
+	})
+
+	return c, dcp
+}
+
+func TestConnector_should_implement_the_controller(t *testing.T) {
+	var c Connector = &connector{}
+	if _, ok := c.(Controller); !ok {
+		t.Error("Expected the connector to implement Controller")
+	}
+}
+
+func TestSnapshot_should_flush_and_commit_when_the_streams_end(t *testing.T) {
+	recorder := bulk.NewRecorder()
+	c, dcp := newTestConnector(t, recorder, endStreams)
+
+	result, err := c.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Expected the snapshot to complete, got %v", err)
+	}
+
+	if len(recorder.Writes()) != 1 || dcp.commits.Load() != 1 {
+		t.Errorf("Expected the batch written and committed, got %d writes and %d commits",
+			len(recorder.Writes()), dcp.commits.Load())
+	}
+	if result.StartTime.IsZero() || result.EndTime.Before(result.StartTime) {
+		t.Errorf("Expected the snapshot to be timed, got %v to %v", result.StartTime, result.EndTime)
+	}
+}
+
+func TestSnapshot_should_be_interrupted_when_the_connector_is_closed(t *testing.T) {
+	recorder := bulk.NewRecorder()
+	c, dcp := newTestConnector(t, recorder, func(*connector) func(d *fakeDcp) { return waitForClose })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	if _, err := c.Snapshot(ctx); !errors.Is(err, ErrSnapshotInterrupted) {
+		t.Fatalf("Expected the snapshot to be interrupted, got %v", err)
+	}
+
+	if dcp.commits.Load() != 0 {
+		t.Errorf("Expected nothing to be committed by the interrupted snapshot, got %d commits", dcp.commits.Load())
+	}
+}
+
+func TestSnapshot_should_return_the_flush_error(t *testing.T) {
+	sinkErr := errors.New("sink unavailable")
+	c, dcp := newTestConnector(t, failingSink{err: sinkErr}, endStreams)
+
+	if _, err := c.Snapshot(context.Background()); !errors.Is(err, sinkErr) {
+		t.Fatalf("Expected the flush error, got %v", err)
+	}
+
+	if dcp.commits.Load() != 0 {
+		t.Errorf("Expected nothing to be committed after the failed flush, got %d commits", dcp.commits.Load())
+	}
+}
+
+func TestStreamEventHandler_should_only_complete_snapshots_at_the_end_of_finite_streams(t *testing.T) {
+	tests := []struct {
+		prepare func(c *connector)
+		name    string
+	}{
+		{name: "infinite mode", prepare: func(c *connector) { c.dcp.GetConfig().Dcp.Mode = dcpconfig.DcpModeInfinite }},
+		{name: "rebalance", prepare: func(c *connector) { c.isRebalancing.Store(true) }},
+		{name: "signal", prepare: func(c *connector) {
+			c.signals = make(chan os.Signal, 1)
+			c.signals <- syscall.SIGTERM
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, dcp := newTestConnector(t, bulk.NewRecorder(), func(*connector) func(d *fakeDcp) { return waitForClose })
+			c.dcp.GetConfig().Dcp.Mode = dcpconfig.DcpModeFinite
+			tt.prepare(c)
+
+			dcp.handler.BeforeStreamStop()
+
+			if c.snapshotResult != nil || dcp.commits.Load() != 0 {
+				t.Errorf("Expected the snapshot not to be completed")
+			}
+		})
+	}
+}
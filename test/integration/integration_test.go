@@ -2,7 +2,6 @@ package integration
 
 import (
 	"context"
-	"sync"
 	"testing"
 	"time"
 
@@ -21,50 +20,38 @@ func TestMongoDB(t *testing.T) {
 		return
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		connector.Start()
-	}()
+	testCtx, testCancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer testCancel()
 
-	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		clientOpts := options.Client().ApplyURI("mongodb://localhost:27017")
-		client, err := mongo.Connect(ctx, clientOpts)
-		if err != nil {
-			t.Fatalf("Failed to connect mongodb: %s", err)
-		}
-		defer client.Disconnect(ctx)
+	controller, ok := connector.(dcpmongodb.Controller)
+	if !ok {
+		t.Fatal("connector does not implement the controller")
+	}
 
-		collection := client.Database("dcp-test").Collection("test")
+	result, err := controller.Snapshot(testCtx)
+	if err != nil {
+		t.Fatalf("snapshot failed: %s", err)
+	}
+	controller.Close()
 
-		testCtx, testCancel := context.WithTimeout(context.Background(), 3*time.Minute)
-		defer testCancel()
+	t.Logf("Snapshot completed in %v: %+v", result.Duration(), result.Collections)
 
-	CountCheckLoop:
-		for {
-			select {
-			case <-testCtx.Done():
-				t.Fatalf("deadline exceed")
-			default:
-				count, err := collection.CountDocuments(context.Background(), bson.M{})
-				if err != nil {
-					t.Fatalf("could not get count from mongodb: %s", err)
-				}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-				t.Logf("Document count: %d", count)
+	clientOpts := options.Client().ApplyURI("mongodb://localhost:27017")
+	client, err := mongo.Connect(ctx, clientOpts)
+	if err != nil {
+		t.Fatalf("Failed to connect mongodb: %s", err)
+	}
+	defer client.Disconnect(ctx)
 
-				if count == 31591 {
-					connector.Close()
-					break CountCheckLoop
-				}
-				time.Sleep(2 * time.Second)
-			}
-		}
-	}()
+	count, err := client.Database("dcp-test").Collection("test").CountDocuments(ctx, bson.M{})
+	if err != nil {
+		t.Fatalf("could not get count from mongodb: %s", err)
+	}
 
-	wg.Wait()
+	if count != 31591 {
+		t.Fatalf("Document count: %d, expected 31591", count)
+	}
 }
@@ -0,0 +1,86 @@
+package verify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// idKey identifies a document by the extended JSON of its _id, so ids of different BSON types never collide.
+func idKey(id bson.RawValue) string {
+	return id.String()
+}
+
+func valueKey(value any) (string, error) {
+	valueType, data, err := bson.MarshalValue(value)
+	if err != nil {
+		return "", err
+	}
+	return idKey(bson.RawValue{Type: valueType, Value: data}), nil
+}
+
+// displayID returns the id of a key as reported, without the extended JSON type wrappers.
+func displayID(key string) string {
+	var document bson.M
+	if err := bson.UnmarshalExtJSON([]byte(`{"id":`+key+`}`), true, &document); err != nil {
+		return key
+	}
+	return fmt.Sprint(document["id"])
+}
+
+// documentHash hashes the content of a document regardless of the order of its fields. The document is
+// decoded from BSON first, so a mapped document hashes like the one MongoDB stores after writing it.
+func documentHash(document bson.Raw) (string, error) {
+	var decoded bson.M
+	if err := bson.Unmarshal(document, &decoded); err != nil {
+		return "", err
+	}
+
+	canonical, err := bson.Marshal(sortedValue(decoded))
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func sortedValue(value any) any {
+	switch v := value.(type) {
+	case bson.M:
+		return sortedDocument(v)
+	case map[string]any:
+		return sortedDocument(v)
+	case bson.D:
+		document := make(map[string]any, len(v))
+		for _, field := range v {
+			document[field.Key] = field.Value
+		}
+		return sortedDocument(document)
+	case bson.A:
+		array := make(bson.A, len(v))
+		for i, item := range v {
+			array[i] = sortedValue(item)
+		}
+		return array
+	default:
+		return v
+	}
+}
+
+func sortedDocument(document map[string]any) bson.D {
+	keys := make([]string, 0, len(document))
+	for key := range document {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	sorted := make(bson.D, 0, len(keys))
+	for _, key := range keys {
+		sorted = append(sorted, bson.E{Key: key, Value: sortedValue(document[key])})
+	}
+	return sorted
+}
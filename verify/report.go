@@ -0,0 +1,47 @@
+package verify
+
+import (
+	"time"
+)
+
+// Report lists the differences between the documents mapped from Couchbase and the documents in MongoDB,
+// keyed by MongoDB collection.
+type Report struct {
+	StartTime   time.Time                    `json:"startTime"`
+	EndTime     time.Time                    `json:"endTime"`
+	Collections map[string]*CollectionReport `json:"collections"`
+}
+
+// IsConsistent reports whether no collection has missing, extra or mismatched documents.
+func (r Report) IsConsistent() bool {
+	for _, collection := range r.Collections {
+		if collection.Missing.Count > 0 || collection.Extra.Count > 0 || collection.Mismatched.Count > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+type CollectionReport struct {
+	// Missing are the documents mapped from Couchbase that are not in MongoDB, Extra the documents in MongoDB
+	// no Couchbase document maps to and Mismatched the documents whose content differs.
+	Missing    Difference `json:"missing"`
+	Extra      Difference `json:"extra"`
+	Mismatched Difference `json:"mismatched"`
+	Expected   int64      `json:"expected"`
+	Actual     int64      `json:"actual"`
+	Repaired   int64      `json:"repaired"`
+}
+
+// Difference counts the documents of a kind of difference and keeps the ids of the first ones.
+type Difference struct {
+	IDs   []string `json:"ids,omitempty"`
+	Count int64    `json:"count"`
+}
+
+func (d *Difference) add(id string, maxReportedIDs int) {
+	d.Count++
+	if len(d.IDs) < maxReportedIDs {
+		d.IDs = append(d.IDs, id)
+	}
+}
@@ -0,0 +1,402 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	godcp "github.com/Trendyol/go-dcp"
+	config "github.com/Trendyol/go-dcp-mongodb/configs"
+	"github.com/Trendyol/go-dcp-mongodb/couchbase"
+	"github.com/Trendyol/go-dcp-mongodb/mongodb"
+	"github.com/Trendyol/go-dcp-mongodb/mongodb/bulk"
+	"github.com/Trendyol/go-dcp-mongodb/mongodb/client"
+	dcpconfig "github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/membership"
+	"github.com/Trendyol/go-dcp/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInterrupted is returned when the verification stops before the streams reached the high seqnos they had when
+// it started, the documents seen so far cannot be compared.
+var ErrInterrupted = errors.New("verification interrupted before reaching the high seqnos")
+
+const defaultMaxReportedIDs = 100
+
+type Options struct {
+	// MaxReportedIDs is the number of ids reported per kind of difference and collection, 100 when zero.
+	MaxReportedIDs int
+	// CompareContent hashes the mapped documents and the documents in MongoDB to find the mismatched ones,
+	// otherwise only the ids are compared.
+	CompareContent bool
+	// Repair writes the mapped document of missing and mismatched documents and deletes extra documents
+	// through Bulk once they are compared.
+	Repair bool
+}
+
+// Verifier streams the documents of the bucket up to the current high seqnos, maps them with the connector's
+// mapper and compares the documents of the Raw models with the documents in MongoDB by _id. It uses its own dcp
+// group and never commits a checkpoint, so it always streams from the start and leaves the connector's one alone.
+type Verifier struct {
+	mongoClient *mongo.Client
+	config      *config.Config
+	mapper      func(event couchbase.Event) []mongodb.Model
+	// couchbaseCollections maps the verified MongoDB collections to a Couchbase collection mapped to them
+	couchbaseCollections map[string]string
+	expected             map[string]map[string]expectedDocument
+	hooks                mongodb.Hooks
+	options              Options
+	lock                 sync.Mutex
+}
+
+type expectedDocument struct {
+	// model is only kept to repair the document
+	model *mongodb.Raw
+	hash  string
+}
+
+// NewVerifier uses mongoClient when given, otherwise it creates its own client from the config for each
+// verification. Collections that are not a copy of the Couchbase documents, written as history only, as
+// versions or as measurements, are not verified.
+func NewVerifier(
+	cfg *config.Config, mapper func(event couchbase.Event) []mongodb.Model, mongoClient *mongo.Client, hooks mongodb.Hooks,
+	options Options,
+) *Verifier {
+	if options.MaxReportedIDs == 0 {
+		options.MaxReportedIDs = defaultMaxReportedIDs
+	}
+
+	couchbaseCollections := make(map[string]string)
+	for couchbaseCollection, collection := range cfg.MongoDB.CollectionMapping {
+		collectionOptions := cfg.MongoDB.CollectionOptions[collection]
+		if (collectionOptions.History.Enabled && collectionOptions.History.Only) ||
+			collectionOptions.SCD.Enabled || collectionOptions.TimeSeries.Enabled {
+			continue
+		}
+
+		if existing, ok := couchbaseCollections[collection]; !ok || couchbaseCollection < existing {
+			couchbaseCollections[collection] = couchbaseCollection
+		}
+	}
+
+	return &Verifier{
+		mongoClient:          mongoClient,
+		config:               cfg,
+		mapper:               mapper,
+		couchbaseCollections: couchbaseCollections,
+		hooks:                hooks,
+		options:              options,
+	}
+}
+
+// Verify compares the collections and returns the differences, repairing them when enabled. The documents seen in
+// Couchbase are kept in memory until they are compared, their ids and, with CompareContent, their hashes.
+func (v *Verifier) Verify(ctx context.Context) (Report, error) {
+	report := Report{
+		StartTime:   time.Now(),
+		Collections: make(map[string]*CollectionReport, len(v.couchbaseCollections)),
+	}
+
+	if err := v.stream(ctx); err != nil {
+		return report, err
+	}
+
+	mongoClient := v.mongoClient
+	if mongoClient == nil {
+		var err error
+		if mongoClient, err = client.NewMongoClient(v.config.MongoDB); err != nil {
+			return report, err
+		}
+		defer func() {
+			_ = mongoClient.Disconnect(context.Background())
+		}()
+	}
+
+	var repairs *bulk.Bulk
+	if v.options.Repair {
+		var err error
+		if repairs, err = v.newRepairBulk(mongoClient, nil); err != nil {
+			return report, err
+		}
+	}
+
+	database := mongoClient.Database(v.config.MongoDB.Connection.Database)
+
+	var errs []error
+	for _, collection := range sortedCollections(v.couchbaseCollections) {
+		collectionReport, err := v.compare(ctx, database.Collection(collection), repairs)
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+		report.Collections[collection] = collectionReport
+	}
+
+	if repairs != nil {
+		if err := repairs.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("error while repairing: %w", err))
+		}
+
+		select {
+		case err := <-repairs.Errors():
+			errs = append(errs, fmt.Errorf("error while repairing: %w", err))
+		default:
+		}
+	}
+
+	report.EndTime = time.Now()
+	return report, errors.Join(errs...)
+}
+
+// newRepairBulk creates the bulk writing the repairs. It provisions nothing and writes the mapped documents as they
+// are, without history records, merges or schema validation, so a repaired document matches the mapped one.
+func (v *Verifier) newRepairBulk(mongoClient *mongo.Client, sink bulk.WriteSink) (*bulk.Bulk, error) {
+	repairConfig := *v.config
+	repairConfig.MongoDB.Provisioning.Disabled = true
+	repairConfig.MongoDB.CollectionOptions = make(map[string]config.CollectionOptions, len(v.config.MongoDB.CollectionOptions))
+	for collection, collectionOptions := range v.config.MongoDB.CollectionOptions {
+		collectionOptions.Merge = config.MergeOptions{}
+		collectionOptions.History = config.HistoryOptions{}
+		collectionOptions.Schema = config.SchemaOptions{}
+		repairConfig.MongoDB.CollectionOptions[collection] = collectionOptions
+	}
+
+	return bulk.NewBulk(&repairConfig, func() {}, mongoClient, v.hooks, sink)
+}
+
+func (v *Verifier) reset() {
+	v.expected = make(map[string]map[string]expectedDocument, len(v.couchbaseCollections))
+	for collection := range v.couchbaseCollections {
+		v.expected[collection] = make(map[string]expectedDocument)
+	}
+}
+
+func (v *Verifier) stream(ctx context.Context) error {
+	v.reset()
+
+	dcpConfig := v.config.Dcp
+	dcpConfig.Dcp.Group.Name += "-verify"
+	dcpConfig.Dcp.Group.Membership = dcpconfig.DCPGroupMembership{
+		Type:         membership.StaticMembershipType,
+		MemberNumber: 1,
+		TotalMembers: 1,
+	}
+	dcpConfig.Dcp.Mode = dcpconfig.DcpModeFinite
+	dcpConfig.Checkpoint.AutoReset = "earliest"
+	dcpConfig.LeaderElection.Enabled = false
+	dcpConfig.API.Disabled = true
+
+	dcp, err := godcp.NewDcp(&dcpConfig, v.listener)
+	if err != nil {
+		return fmt.Errorf("error while creating dcp client: %w", err)
+	}
+	dcp.GetConfig().Checkpoint.Type = "manual"
+
+	// go-dcp closes the streams on these signals too, they must not be taken for the end of the streams
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGABRT, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	go func() {
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			dcp.Close()
+		}
+	}()
+
+	dcp.Start()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(signals) > 0 {
+		return ErrInterrupted
+	}
+
+	return nil
+}
+
+func (v *Verifier) listener(ctx *models.ListenerContext) {
+	event, ok := couchbase.NewEvent(ctx.Event)
+	if !ok {
+		return
+	}
+
+	collection := v.config.MongoDB.CollectionMapping[event.CollectionName]
+	if _, ok := v.couchbaseCollections[collection]; !ok {
+		return
+	}
+
+	for _, action := range v.mapper(event) {
+		// only Raw models identify a single document by its _id
+		if rawModel, ok := action.(*mongodb.Raw); ok {
+			if err := v.expect(collection, rawModel); err != nil {
+				logger.Log.Error("skipping verification of document %v of %s: %v", rawModel.ID, collection, err)
+			}
+		}
+	}
+}
+
+func (v *Verifier) expect(collection string, rawModel *mongodb.Raw) error {
+	id := rawModel.Document["_id"]
+	if id == nil {
+		id = rawModel.ID
+	}
+
+	key, err := valueKey(id)
+	if err != nil {
+		return err
+	}
+
+	var expected expectedDocument
+	if rawModel.Operation != mongodb.Delete && v.options.CompareContent {
+		document, err := bson.Marshal(rawModel.Document)
+		if err != nil {
+			return err
+		}
+		if expected.hash, err = documentHash(document); err != nil {
+			return err
+		}
+	}
+	if v.options.Repair {
+		expected.model = rawModel
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if rawModel.Operation == mongodb.Delete {
+		delete(v.expected[collection], key)
+	} else {
+		v.expected[collection][key] = expected
+	}
+
+	return nil
+}
+
+// compare reads the documents of the collection and takes the expected ones off as they are found,
+// the expected documents left are missing.
+func (v *Verifier) compare(ctx context.Context, collection *mongo.Collection, repairs *bulk.Bulk) (*CollectionReport, error) {
+	expected := v.expected[collection.Name()]
+	report := &CollectionReport{Expected: int64(len(expected))}
+
+	findOptions := options.Find()
+	if !v.options.CompareContent && !v.options.Repair {
+		findOptions.SetProjection(bson.M{"_id": 1})
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading %s: %w", collection.Name(), err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		report.Actual++
+		key := idKey(cursor.Current.Lookup("_id"))
+
+		document, ok := expected[key]
+		if !ok {
+			report.Extra.add(displayID(key), v.options.MaxReportedIDs)
+			if err := v.repairExtra(repairs, collection.Name(), cursor.Current, report); err != nil {
+				return nil, fmt.Errorf("error while reading %s: %w", collection.Name(), err)
+			}
+			continue
+		}
+		delete(expected, key)
+
+		if !v.options.CompareContent {
+			continue
+		}
+
+		hash, err := documentHash(cursor.Current)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading %s: %w", collection.Name(), err)
+		}
+		if hash != document.hash {
+			report.Mismatched.add(displayID(key), v.options.MaxReportedIDs)
+			v.repair(repairs, collection.Name(), document.model, report)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error while reading %s: %w", collection.Name(), err)
+	}
+
+	keys := make([]string, 0, len(expected))
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		report.Missing.add(displayID(key), v.options.MaxReportedIDs)
+		v.repair(repairs, collection.Name(), expected[key].model, report)
+	}
+
+	return report, nil
+}
+
+// repair enqueues the mapped document as a replacement, a merge cannot remove the fields a mismatched document has
+// in excess and an insert fails on the existing document.
+func (v *Verifier) repair(repairs *bulk.Bulk, collection string, rawModel *mongodb.Raw, report *CollectionReport) {
+	if repairs == nil {
+		return
+	}
+
+	fix := *rawModel
+	fix.Operation = mongodb.Upsert
+
+	v.addRepair(repairs, collection, &fix)
+	report.Repaired++
+}
+
+func (v *Verifier) repairExtra(repairs *bulk.Bulk, collection string, document bson.Raw, report *CollectionReport) error {
+	if repairs == nil {
+		return nil
+	}
+
+	// the whole document is kept, the delete filters on the shard keys as well
+	var decoded bson.M
+	if err := bson.Unmarshal(document, &decoded); err != nil {
+		return err
+	}
+
+	v.addRepair(repairs, collection, &mongodb.Raw{
+		ID:        fmt.Sprint(decoded["_id"]),
+		Document:  decoded,
+		Operation: mongodb.Delete,
+	})
+	report.Repaired++
+
+	return nil
+}
+
+func (v *Verifier) addRepair(repairs *bulk.Bulk, collection string, model mongodb.Model) {
+	ctx := &models.ListenerContext{
+		Commit: func() {},
+		Ack:    func() {},
+	}
+	repairs.AddActions(ctx, time.Now(), []mongodb.Model{model}, v.couchbaseCollections[collection], 0)
+}
+
+func sortedCollections(couchbaseCollections map[string]string) []string {
+	collections := make([]string, 0, len(couchbaseCollections))
+	for collection := range couchbaseCollections {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+	return collections
+}
@@ -0,0 +1,179 @@
+package verify
+
+import (
+	"context"
+	"testing"
+
+	config "github.com/Trendyol/go-dcp-mongodb/configs"
+	"github.com/Trendyol/go-dcp-mongodb/mongodb"
+	"github.com/Trendyol/go-dcp-mongodb/mongodb/bulk"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func Test_documentHash_should_ignore_field_order(t *testing.T) {
+	mapped, _ := bson.Marshal(bson.M{"_id": "1", "name": "a", "address": bson.M{"city": "x", "zip": 34000}, "tags": bson.A{"b", "a"}})
+	stored, _ := bson.Marshal(bson.D{
+		{Key: "tags", Value: bson.A{"b", "a"}},
+		{Key: "address", Value: bson.D{{Key: "zip", Value: 34000}, {Key: "city", Value: "x"}}},
+		{Key: "name", Value: "a"},
+		{Key: "_id", Value: "1"},
+	})
+	changed, _ := bson.Marshal(bson.M{"_id": "1", "name": "a", "address": bson.M{"city": "x", "zip": 34000}, "tags": bson.A{"a", "b"}})
+
+	mappedHash, err := documentHash(mapped)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	storedHash, _ := documentHash(stored)
+	changedHash, _ := documentHash(changed)
+
+	if mappedHash != storedHash {
+		t.Errorf("Expected documents with the same fields in another order to hash the same")
+	}
+	if mappedHash == changedHash {
+		t.Errorf("Expected documents with reordered array items to hash differently")
+	}
+}
+
+func Test_valueKey_should_tell_id_types_apart(t *testing.T) {
+	stringKey, _ := valueKey("1")
+	intKey, _ := valueKey(int32(1))
+
+	if stringKey == intKey {
+		t.Errorf("Expected string and int ids to have different keys, got %s", stringKey)
+	}
+	if id := displayID(stringKey); id != "1" {
+		t.Errorf("Expected string id to be reported without quotes, got %s", id)
+	}
+	if id := displayID(intKey); id != "1" {
+		t.Errorf("Expected int id to be reported as is, got %s", id)
+	}
+}
+
+func Test_Difference_should_count_all_and_report_first_ids(t *testing.T) {
+	var difference Difference
+	for _, id := range []string{"a", "b", "c"} {
+		difference.add(id, 2)
+	}
+
+	if difference.Count != 3 || len(difference.IDs) != 2 || difference.IDs[1] != "b" {
+		t.Errorf("Expected 3 differences with ids [a b], got %d with %v", difference.Count, difference.IDs)
+	}
+}
+
+func Test_NewVerifier_should_skip_collections_that_are_not_copies(t *testing.T) {
+	cfg := &config.Config{MongoDB: config.MongoDB{
+		CollectionMapping: map[string]string{
+			"_default": "users", "archive": "users", "events": "events", "prices": "prices", "audit": "audit",
+		},
+		CollectionOptions: map[string]config.CollectionOptions{
+			"events": {TimeSeries: config.TimeSeriesOptions{Enabled: true, TimeField: "time"}},
+			"prices": {SCD: config.SCDOptions{Enabled: true}},
+			"audit":  {History: config.HistoryOptions{Enabled: true, Only: true}},
+		},
+	}}
+
+	verifier := NewVerifier(cfg, nil, nil, mongodb.Hooks{}, Options{})
+
+	if len(verifier.couchbaseCollections) != 1 || verifier.couchbaseCollections["users"] != "_default" {
+		t.Errorf("Expected only users to be verified from _default, got %v", verifier.couchbaseCollections)
+	}
+	if verifier.options.MaxReportedIDs != defaultMaxReportedIDs {
+		t.Errorf("Expected default max reported ids, got %d", verifier.options.MaxReportedIDs)
+	}
+}
+
+func Test_expect_should_keep_mapped_documents_until_deleted(t *testing.T) {
+	cfg := &config.Config{MongoDB: config.MongoDB{CollectionMapping: map[string]string{"_default": "users"}}}
+
+	verifier := NewVerifier(cfg, nil, nil, mongodb.Hooks{}, Options{CompareContent: true})
+	verifier.reset()
+
+	for _, rawModel := range []*mongodb.Raw{
+		{ID: "1", Document: bson.M{"_id": "1", "value": "a"}, Operation: mongodb.Upsert},
+		{ID: "2", Document: bson.M{"_id": "2", "value": "b"}, Operation: mongodb.Insert},
+		{ID: "2", Document: bson.M{"_id": "2"}, Operation: mongodb.Delete},
+	} {
+		if err := verifier.expect("users", rawModel); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	expected := verifier.expected["users"]
+	key, _ := valueKey("1")
+	if len(expected) != 1 || expected[key].hash == "" {
+		t.Fatalf("Expected only document 1 with its hash, got %v", expected)
+	}
+	if expected[key].model != nil {
+		t.Errorf("Expected the model to be kept for repairs only")
+	}
+
+	stored, _ := bson.Marshal(bson.D{{Key: "value", Value: "a"}, {Key: "_id", Value: "1"}})
+	if hash, _ := documentHash(stored); hash != expected[key].hash {
+		t.Errorf("Expected the hash of the stored document to match the mapped one")
+	}
+}
+
+func Test_repair_should_replace_documents_without_history_or_provisioning(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:27017"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{MongoDB: config.MongoDB{
+		Connection:        config.Connection{Database: "test_db"},
+		CollectionMapping: map[string]string{"_default": "users"},
+		CollectionOptions: map[string]config.CollectionOptions{
+			"users": {
+				Merge:   config.MergeOptions{Default: true},
+				History: config.HistoryOptions{Enabled: true},
+				Create:  config.CreateOptions{Capped: true, SizeBytes: 1024},
+			},
+		},
+	}}
+	cfg.ApplyDefaults()
+
+	verifier := NewVerifier(cfg, nil, mongoClient, mongodb.Hooks{}, Options{Repair: true})
+
+	recorder := bulk.NewRecorder()
+	repairs, err := verifier.newRepairBulk(mongoClient, recorder)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status := repairs.Status(); len(status.Provisioning) != 0 {
+		t.Errorf("Expected nothing to be provisioned, got %v", status.Provisioning)
+	}
+
+	report := &CollectionReport{}
+	verifier.repair(repairs, "users", &mongodb.Raw{ID: "1", Document: bson.M{"_id": "1", "name": "a"}, Operation: mongodb.Merge}, report)
+	stored, _ := bson.Marshal(bson.M{"_id": "2", "name": "b"})
+	if err := verifier.repairExtra(repairs, "users", stored, report); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := repairs.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	writes := recorder.Writes()
+	if len(writes) != 2 || report.Repaired != 2 {
+		t.Fatalf("Expected the replacement and the delete only, got %d writes", len(writes))
+	}
+	for _, write := range writes {
+		if write.Collection != "users" {
+			t.Errorf("Expected repairs of users only, got a write to %s", write.Collection)
+		}
+	}
+	if _, ok := writes[0].Model.(*mongo.ReplaceOneModel); !ok {
+		t.Errorf("Expected the mismatched document to be replaced, got %T", writes[0].Model)
+	}
+	if _, ok := writes[1].Model.(*mongo.DeleteOneModel); !ok {
+		t.Errorf("Expected the extra document to be deleted, got %T", writes[1].Model)
+	}
+
+	if err := mongoClient.Disconnect(context.Background()); err != nil {
+		t.Errorf("Expected the supplied client to be left connected, got %v", err)
+	}
+}